@@ -0,0 +1,40 @@
+package action
+
+import (
+	"github.com/juju/loggo"
+	"lostbearlabs.com/ddet/filedb"
+)
+
+var logger = loggo.GetLogger("action")
+
+// The outcome of acting on one group of duplicates.
+type Result struct {
+	// the file that was kept
+	Keeper filedb.FileEntry
+	// files that were acted on (or would have been, for a dry run)
+	Done []filedb.FileEntry
+	// files that were left alone because acting on them failed or was
+	// refused
+	Failed []filedb.FileEntry
+	// the number of bytes freed
+	Reclaimed int64
+}
+
+// Counts the bytes freed by acting on the files in Done:  one copy for
+// each underlying file, unless it is the keeper's.
+func (r *Result) countReclaimed() {
+	seen := make(map[[2]int64]bool)
+	for _, entry := range r.Done {
+		if entry.IsSameFile(&r.Keeper) {
+			continue
+		}
+		if entry.Inode != 0 {
+			id := [2]int64{entry.Device, entry.Inode}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		r.Reclaimed += entry.Length
+	}
+}
@@ -0,0 +1,105 @@
+package action
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The actions that can be recorded in a Journal.
+const (
+	ActionDelete     = "delete"
+	ActionQuarantine = "quarantine"
+)
+
+// One file that was removed from a group of duplicates.  The hash and
+// length let the file be checked when it is restored;  a deleted file
+// is restored by copying the Keeper, and a quarantined one by moving it
+// back from the Destination.
+type JournalEntry struct {
+	Action      string `json:"action"`
+	Path        string `json:"path"`
+	Length      int64  `json:"length"`
+	LastMod     int64  `json:"lastMod"`
+	HashAlg     string `json:"hashAlg"`
+	Hash        string `json:"hash"`
+	Keeper      string `json:"keeper"`
+	Destination string `json:"destination,omitempty"`
+	Time        int64  `json:"time"`
+}
+
+// A record of the files removed by a run, written as JSON lines so
+// that it can be read back by Undo().  Each entry is synced to disk as
+// soon as it is written, so the journal survives the program being
+// interrupted.
+//
+// A Journal should be acquired via CreateJournal() and *must* be closed
+// by calling Close().
+type Journal struct {
+	path string
+	file *os.File
+	enc  *json.Encoder
+	mx   sync.Mutex
+}
+
+// Creates a new journal, along with any folders leading to it.  It is
+// an error for the journal to exist already.
+func CreateJournal(path string) (*Journal, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: path, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Returns the path the journal is written to.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+func (j *Journal) Record(entry JournalEntry) error {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	err := j.enc.Encode(entry)
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Reads all the entries in a journal, in the order they were written.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var result []JournalEntry
+	lines := bufio.NewScanner(file)
+	lines.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; lines.Scan(); n++ {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		err := json.Unmarshal(lines.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, n, err)
+		}
+		result = append(result, entry)
+	}
+	return result, lines.Err()
+}
@@ -0,0 +1,60 @@
+package action
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestJournalRoundTrip(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	path := dir + "/sub/journal.jsonl"
+	journal, err := CreateJournal(path)
+	if err != nil {
+		t.Fatal("unable to create journal: ", err)
+	}
+	entries := []JournalEntry{
+		{Action: ActionDelete, Path: "/a/file1", Length: 20, LastMod: 100, HashAlg: "md5", Hash: "abc", Keeper: "/a/file0", Time: 200},
+		{Action: ActionQuarantine, Path: "/a/file2", Length: 20, LastMod: 100, HashAlg: "md5", Hash: "abc", Keeper: "/a/file0", Destination: "/trash/a/file2", Time: 200},
+	}
+	for _, entry := range entries {
+		err := journal.Record(entry)
+		if err != nil {
+			t.Error("unable to record entry: ", err)
+		}
+	}
+	journal.Close()
+
+	read, err := ReadJournal(path)
+	if err != nil {
+		t.Fatal("unable to read journal: ", err)
+	}
+	if len(read) != len(entries) {
+		t.Fatal("wrong number of entries, got ", read)
+	}
+	for i := range entries {
+		if read[i] != entries[i] {
+			t.Error("bad entry, expected=", entries[i], ", got=", read[i])
+		}
+	}
+
+	_, err = CreateJournal(path)
+	if err == nil {
+		t.Error("should not overwrite an existing journal")
+	}
+}
+
+func TestReadJournalReportsBadLines(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	path := dir + "/journal.jsonl"
+	ioutil.WriteFile(path, []byte("{\"action\":\"delete\"}\nnot json\n"), 0644)
+
+	_, err := ReadJournal(path)
+	if err == nil {
+		t.Error("should have failed to read the journal")
+	}
+}
@@ -0,0 +1,74 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/filedb"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+var tempCounter uint64
+
+// Replaces every file in a group of identical files, other than the
+// keeper, with a hardlink to the keeper.  Each file is replaced
+// atomically, by creating the link under a temporary name in the same
+// folder and renaming it over the original, so there is never a moment
+// when the path doesn't exist.  Files on a different filesystem from
+// the keeper can't be linked to it, so they are left alone.  The FileDB
+// is updated to match each replaced file.
+//
+// The caller is responsible for confirming that the files really are
+// identical, e.g. with verify.Group().
+func Link(db *filedb.FileDB, entries []filedb.FileEntry, keeper int, dryRun bool) *Result {
+	result := &Result{Keeper: entries[keeper]}
+	kept := &entries[keeper]
+
+	for i, entry := range entries {
+		if i == keeper || entry.IsSameFile(kept) {
+			continue
+		}
+		if entry.Device != kept.Device {
+			logger.Warningf("not linking %s to %s:  they are on different filesystems", entry.Path, kept.Path)
+			result.Failed = append(result.Failed, entry)
+			continue
+		}
+
+		if !dryRun {
+			err := replaceWithLink(kept.Path, entry.Path)
+			if err != nil {
+				logger.Errorf("unable to link %s to %s: %v", entry.Path, kept.Path, err)
+				result.Failed = append(result.Failed, entry)
+				continue
+			}
+
+			updated := entry
+			updated.SetDevice(kept.Device).SetInode(kept.Inode).SetLastMod(kept.LastMod)
+			err = db.StoreFileEntry(updated)
+			if err != nil {
+				logger.Errorf("Error [%v] storing [%v]", err, updated)
+			}
+		}
+		result.Done = append(result.Done, entry)
+	}
+
+	result.countReclaimed()
+	return result
+}
+
+func replaceWithLink(keeper string, target string) error {
+	tmp := filepath.Join(filepath.Dir(target), fmt.Sprintf(".ddet-link-%d-%d", os.Getpid(), atomic.AddUint64(&tempCounter, 1)))
+	err := os.Link(keeper, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, target)
+	if err != nil {
+		if rmErr := os.Remove(tmp); rmErr != nil {
+			return errors.New(err.Error() + ", and unable to remove " + tmp + ": " + rmErr.Error())
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package action
+
+import (
+	"io/ioutil"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/scanner"
+	"os"
+	"testing"
+)
+
+// Writes identical files, scans them, and returns their entries.
+func scanTestFiles(t *testing.T, db *filedb.FileDB, dir string, names ...string) []filedb.FileEntry {
+	for _, name := range names {
+		ioutil.WriteFile(dir+"/"+name, []byte("constant text string"), 0644)
+	}
+
+	s := scanner.MakeScanner(db, scanner.DefaultOptions())
+	s.ScanFiles(dir)
+
+	var entries []filedb.FileEntry
+	for _, name := range names {
+		entry := db.ReadFileEntry(dir + "/" + name)
+		if entry == nil || entry.Inode == 0 {
+			t.Skip("inodes not supported")
+		}
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+func TestLink(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2", "file3")
+
+	result := Link(db, entries, 1, false)
+	if len(result.Done) != 2 || len(result.Failed) != 0 {
+		t.Error("should have linked 2 files, got ", result)
+	}
+	if result.Reclaimed != 2*entries[0].Length {
+		t.Error("wrong reclaimed bytes, got ", result.Reclaimed)
+	}
+
+	keeper, _ := os.Stat(dir + "/file2")
+	for _, name := range []string{"/file1", "/file3"} {
+		stat, _ := os.Stat(dir + name)
+		if !os.SameFile(keeper, stat) {
+			t.Error("file should have been linked: ", name)
+		}
+		entry := db.ReadFileEntry(dir + name)
+		if !entry.IsSameFile(&entries[1]) {
+			t.Error("database should have been updated, got ", entry)
+		}
+	}
+
+	leftovers, _ := ioutil.ReadDir(dir)
+	if len(leftovers) != 3 {
+		t.Error("temporary links should have been renamed, got ", len(leftovers), " files")
+	}
+}
+
+func TestLinkDryRun(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2")
+
+	result := Link(db, entries, 0, true)
+	if len(result.Done) != 1 {
+		t.Error("should have reported 1 file, got ", result)
+	}
+
+	stat1, _ := os.Stat(dir + "/file1")
+	stat2, _ := os.Stat(dir + "/file2")
+	if os.SameFile(stat1, stat2) {
+		t.Error("dry run should not have linked files")
+	}
+}
+
+func TestLinkRefusesOtherFilesystems(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2")
+	entries[1].Device++
+
+	result := Link(db, entries, 0, false)
+	if len(result.Done) != 0 || len(result.Failed) != 1 {
+		t.Error("should have refused to link, got ", result)
+	}
+
+	stat1, _ := os.Stat(dir + "/file1")
+	stat2, _ := os.Stat(dir + "/file2")
+	if os.SameFile(stat1, stat2) {
+		t.Error("files should not have been linked")
+	}
+}
@@ -0,0 +1,195 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Deletes every file in a group of identical files other than the
+// keeper.  Each deletion is recorded in the journal before it is made,
+// and the FileDB entry for each deleted file is removed.
+//
+// The caller is responsible for confirming that the files really are
+// identical, e.g. with verify.Group().
+func Delete(db *filedb.FileDB, entries []filedb.FileEntry, keeper int, journal *Journal, dryRun bool) *Result {
+	apply := func(entry *filedb.FileEntry, dest string) error {
+		return os.Remove(entry.Path)
+	}
+	return remove(db, entries, keeper, journal, dryRun, ActionDelete, nil, apply)
+}
+
+// Moves every file in a group of identical files other than the keeper
+// into the trash folder, at the same path beneath it as the file had
+// originally.  Each move is recorded in the journal before it is made,
+// and the FileDB entry for each moved file is removed.
+//
+// The caller is responsible for confirming that the files really are
+// identical, e.g. with verify.Group().
+func Quarantine(db *filedb.FileDB, entries []filedb.FileEntry, keeper int, trashDir string, journal *Journal, dryRun bool) *Result {
+	destination := func(entry *filedb.FileEntry) (string, error) {
+		return quarantinePath(trashDir, entry.Path)
+	}
+	apply := func(entry *filedb.FileEntry, dest string) error {
+		return moveFile(entry.Path, dest)
+	}
+	return remove(db, entries, keeper, journal, dryRun, ActionQuarantine, destination, apply)
+}
+
+// Removes the files in a group other than the keeper.  The destination
+// function, if any, says where each file is moved to, and the apply
+// function does the removing.  Nothing is removed unless it has been
+// recorded in the journal first;  the journal may be nil for a dry run.
+func remove(db *filedb.FileDB, entries []filedb.FileEntry, keeper int, journal *Journal, dryRun bool, action string,
+	destination func(entry *filedb.FileEntry) (string, error), apply func(entry *filedb.FileEntry, dest string) error) *Result {
+	result := &Result{Keeper: entries[keeper]}
+	kept := &entries[keeper]
+	now := time.Now().Unix()
+
+	for i := range entries {
+		if i == keeper {
+			continue
+		}
+		entry := &entries[i]
+
+		record := JournalEntry{
+			Action:  action,
+			Path:    entry.Path,
+			Length:  entry.Length,
+			LastMod: entry.LastMod,
+			HashAlg: entry.HashAlg,
+			Hash:    entry.Hash,
+			Keeper:  kept.Path,
+			Time:    now,
+		}
+		if destination != nil {
+			dest, err := destination(entry)
+			if err != nil {
+				logger.Errorf("unable to %s %s: %v", action, entry.Path, err)
+				result.Failed = append(result.Failed, *entry)
+				continue
+			}
+			record.Destination = dest
+		}
+
+		if !dryRun {
+			err := journal.Record(record)
+			if err != nil {
+				logger.Errorf("unable to record %s in journal, leaving it alone: %v", entry.Path, err)
+				result.Failed = append(result.Failed, *entry)
+				continue
+			}
+
+			err = apply(entry, record.Destination)
+			if err != nil {
+				logger.Errorf("unable to %s %s: %v", action, entry.Path, err)
+				result.Failed = append(result.Failed, *entry)
+				continue
+			}
+
+			err = db.DeleteFileEntry(entry.Path)
+			if err != nil {
+				logger.Errorf("Error [%v] deleting entry for %s", err, entry.Path)
+			}
+		}
+		result.Done = append(result.Done, *entry)
+	}
+
+	result.countReclaimed()
+	return result
+}
+
+// Returns the path a file is moved to when it is quarantined.  The file's
+// absolute path is recreated beneath the trash folder.
+func quarantinePath(trashDir string, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	volume := filepath.VolumeName(abs)
+	rest := abs[len(volume):]
+	// e.g. C: or \\server\share, neither of which can be a folder name
+	volume = strings.Trim(strings.Replace(volume, ":", "", -1), `\/`)
+	return filepath.Join(trashDir, volume, rest), nil
+}
+
+// Moves a file, creating any folders leading to the destination.  The
+// destination must not exist already.  Files are renamed where
+// possible, or else copied and removed.
+func moveFile(src string, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return errors.New("destination already exists: " + dst)
+	}
+
+	err = os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	err = copyFile(src, dst)
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Copies a file, along with its permissions and modification time.  The
+// destination must not exist already, and is removed if the copy fails.
+func copyFile(src string, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, time.Now(), info.ModTime())
+}
+
+// Creates a trash folder, if it doesn't exist already, with an ignore
+// file in it so that later scans leave the quarantined files out.
+func PrepareTrash(trashDir string) error {
+	err := os.MkdirAll(trashDir, 0755)
+	if err != nil {
+		return err
+	}
+	ignore := filepath.Join(trashDir, filter.DdetIgnore)
+	if _, err := os.Stat(ignore); err == nil {
+		return nil
+	}
+	return ioutil.WriteFile(ignore, []byte("*\n"), 0644)
+}
@@ -0,0 +1,123 @@
+package action
+
+import (
+	"io/ioutil"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"os"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2", "file3")
+	journal, _ := CreateJournal(dir + "/journal/j.jsonl")
+
+	result := Delete(db, entries, 1, journal, false)
+	journal.Close()
+	if len(result.Done) != 2 || len(result.Failed) != 0 {
+		t.Error("should have deleted 2 files, got ", result)
+	}
+	if result.Reclaimed != 2*entries[0].Length {
+		t.Error("wrong reclaimed bytes, got ", result.Reclaimed)
+	}
+
+	for _, name := range []string{"/file1", "/file3"} {
+		if _, err := os.Stat(dir + name); !os.IsNotExist(err) {
+			t.Error("file should have been deleted: ", name)
+		}
+		if db.ReadFileEntry(dir+name) != nil {
+			t.Error("database entry should have been deleted: ", name)
+		}
+	}
+	if _, err := os.Stat(dir + "/file2"); err != nil {
+		t.Error("keeper should not have been deleted")
+	}
+
+	recorded, _ := ReadJournal(dir + "/journal/j.jsonl")
+	if len(recorded) != 2 || recorded[0].Path != dir+"/file1" || recorded[0].Keeper != dir+"/file2" || recorded[0].Hash != entries[0].Hash {
+		t.Error("bad journal, got ", recorded)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2")
+	trash := dir + "/trash"
+	journal, _ := CreateJournal(trash + "/j.jsonl")
+
+	result := Quarantine(db, entries, 0, trash, journal, false)
+	journal.Close()
+	if len(result.Done) != 1 || len(result.Failed) != 0 {
+		t.Error("should have quarantined 1 file, got ", result)
+	}
+
+	if _, err := os.Stat(dir + "/file2"); !os.IsNotExist(err) {
+		t.Error("file should have been moved")
+	}
+	if _, err := os.Stat(trash + dir + "/file2"); err != nil {
+		t.Error("file should be in the trash: ", err)
+	}
+	if db.ReadFileEntry(dir+"/file2") != nil {
+		t.Error("database entry should have been deleted")
+	}
+
+	recorded, _ := ReadJournal(trash + "/j.jsonl")
+	if len(recorded) != 1 || recorded[0].Destination != trash+dir+"/file2" {
+		t.Error("bad journal, got ", recorded)
+	}
+}
+
+func TestRemoveDryRun(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2")
+
+	result := Delete(db, entries, 0, nil, true)
+	if len(result.Done) != 1 {
+		t.Error("should have reported 1 file, got ", result)
+	}
+	result = Quarantine(db, entries, 0, dir+"/trash", nil, true)
+	if len(result.Done) != 1 {
+		t.Error("should have reported 1 file, got ", result)
+	}
+
+	if _, err := os.Stat(dir + "/file2"); err != nil {
+		t.Error("dry run should not have removed the file")
+	}
+	if db.ReadFileEntry(dir+"/file2") == nil {
+		t.Error("dry run should not have changed the database")
+	}
+}
+
+func TestPrepareTrash(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	err := PrepareTrash(dir + "/trash")
+	if err != nil {
+		t.Fatal("unable to prepare trash: ", err)
+	}
+	data, _ := ioutil.ReadFile(dir + "/trash/" + filter.DdetIgnore)
+	if string(data) != "*\n" {
+		t.Error("trash should be ignored by later scans, got ", string(data))
+	}
+
+	ioutil.WriteFile(dir+"/trash/"+filter.DdetIgnore, []byte("custom\n"), 0644)
+	PrepareTrash(dir + "/trash")
+	data, _ = ioutil.ReadFile(dir + "/trash/" + filter.DdetIgnore)
+	if string(data) != "custom\n" {
+		t.Error("existing ignore file should be left alone, got ", string(data))
+	}
+}
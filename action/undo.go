@@ -0,0 +1,139 @@
+package action
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/hashing"
+	"lostbearlabs.com/ddet/scanner"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// The outcome of undoing a journal.
+type UndoResult struct {
+	// files that were restored (or would have been, for a dry run)
+	Restored []JournalEntry
+	// files that were left alone because something already exists at
+	// their original path
+	Skipped []JournalEntry
+	// files that could not be restored
+	Failed []JournalEntry
+}
+
+// Restores the files recorded in a journal, most recent first.  A
+// quarantined file is moved back from the trash folder, and a deleted
+// file is restored by copying the file that was kept in its place.
+// Either way, the file's contents are checked against the hash in the
+// journal before it is restored, and a FileDB entry is stored for it.
+// Files whose original path has been reused are left alone.
+func Undo(db *filedb.FileDB, entries []JournalEntry, dryRun bool) *UndoResult {
+	result := &UndoResult{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+
+		if _, err := os.Lstat(entry.Path); err == nil {
+			logger.Warningf("not restoring %s:  it already exists", entry.Path)
+			result.Skipped = append(result.Skipped, entry)
+			continue
+		}
+
+		err := restore(db, entry, dryRun)
+		if err != nil {
+			logger.Errorf("unable to restore %s: %v", entry.Path, err)
+			result.Failed = append(result.Failed, entry)
+			continue
+		}
+		result.Restored = append(result.Restored, entry)
+	}
+	return result
+}
+
+func restore(db *filedb.FileDB, entry JournalEntry, dryRun bool) error {
+	var src string
+	switch entry.Action {
+	case ActionDelete:
+		src = entry.Keeper
+	case ActionQuarantine:
+		src = entry.Destination
+	default:
+		return errors.New("unknown action: " + entry.Action)
+	}
+
+	err := checkContents(src, entry)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(entry.Path), 0755)
+	if err != nil {
+		return err
+	}
+	if entry.Action == ActionQuarantine {
+		err = moveFile(src, entry.Path)
+	} else {
+		err = copyToNewFile(src, entry.Path)
+	}
+	if err != nil {
+		return err
+	}
+
+	lastMod := time.Unix(entry.LastMod, 0)
+	err = os.Chtimes(entry.Path, time.Now(), lastMod)
+	if err != nil {
+		return err
+	}
+
+	// the scanner will fill in the device and inode next time around
+	item := filedb.NewBlankFileEntry().
+		SetPath(entry.Path).
+		SetLength(entry.Length).
+		SetLastMod(entry.LastMod).
+		SetHashAlg(entry.HashAlg).
+		SetHash(entry.Hash).
+		SetScanTime(time.Now().Unix())
+	err = db.StoreFileEntry(*item)
+	if err != nil {
+		logger.Errorf("Error [%v] storing [%v]", err, item)
+	}
+	return nil
+}
+
+// Checks that the file we're restoring from still has the contents
+// recorded in the journal.
+func checkContents(path string, entry JournalEntry) error {
+	hasher, err := hashing.Lookup(entry.HashAlg)
+	if err != nil {
+		return err
+	}
+	hash, err := scanner.ComputeHash(path, hasher)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash) != entry.Hash {
+		return fmt.Errorf("%s no longer matches the journal", path)
+	}
+	return nil
+}
+
+// Copies a file under a temporary name in the destination folder, then
+// renames it into place, so a partial copy is never left at the
+// destination.
+func copyToNewFile(src string, dst string) error {
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".ddet-restore-%d-%d", os.Getpid(), atomic.AddUint64(&tempCounter, 1)))
+	err := copyFile(src, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, dst)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package action
+
+import (
+	"io/ioutil"
+	"lostbearlabs.com/ddet/filedb"
+	"os"
+	"testing"
+)
+
+func TestUndoDelete(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2")
+	journal, _ := CreateJournal(dir + "/j.jsonl")
+	Delete(db, entries, 0, journal, false)
+	journal.Close()
+
+	recorded, _ := ReadJournal(dir + "/j.jsonl")
+	result := Undo(db, recorded, false)
+	if len(result.Restored) != 1 || len(result.Failed) != 0 {
+		t.Error("should have restored 1 file, got ", result)
+	}
+
+	data, err := ioutil.ReadFile(dir + "/file2")
+	if err != nil || string(data) != "constant text string" {
+		t.Error("file should have been restored, got ", string(data), err)
+	}
+	stat, _ := os.Stat(dir + "/file2")
+	if stat.ModTime().Unix() != entries[1].LastMod {
+		t.Error("modification time should have been restored, got ", stat.ModTime())
+	}
+	entry := db.ReadFileEntry(dir + "/file2")
+	if entry == nil || entry.Hash != entries[1].Hash {
+		t.Error("database entry should have been restored, got ", entry)
+	}
+}
+
+func TestUndoQuarantine(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2")
+	trash := dir + "/trash"
+	journal, _ := CreateJournal(trash + "/j.jsonl")
+	Quarantine(db, entries, 0, trash, journal, false)
+	journal.Close()
+
+	recorded, _ := ReadJournal(trash + "/j.jsonl")
+	result := Undo(db, recorded, false)
+	if len(result.Restored) != 1 || len(result.Failed) != 0 {
+		t.Error("should have restored 1 file, got ", result)
+	}
+
+	if _, err := os.Stat(dir + "/file2"); err != nil {
+		t.Error("file should have been moved back: ", err)
+	}
+	if _, err := os.Stat(trash + dir + "/file2"); !os.IsNotExist(err) {
+		t.Error("file should no longer be in the trash")
+	}
+}
+
+func TestUndoSkipsExistingAndChangedFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	entries := scanTestFiles(t, db, dir, "file1", "file2", "file3")
+	journal, _ := CreateJournal(dir + "/j.jsonl")
+	Delete(db, entries, 0, journal, false)
+	journal.Close()
+
+	// file2's path has been reused, and the keeper has changed
+	ioutil.WriteFile(dir+"/file2", []byte("new contents"), 0644)
+	recorded, _ := ReadJournal(dir + "/j.jsonl")
+	ioutil.WriteFile(dir+"/file1", []byte("changed contents"), 0644)
+
+	result := Undo(db, recorded, false)
+	if len(result.Skipped) != 1 || len(result.Failed) != 1 || len(result.Restored) != 0 {
+		t.Error("should have skipped 1 file and failed 1, got ", result)
+	}
+
+	data, _ := ioutil.ReadFile(dir + "/file2")
+	if string(data) != "new contents" {
+		t.Error("existing file should not have been overwritten")
+	}
+	if _, err := os.Stat(dir + "/file3"); !os.IsNotExist(err) {
+		t.Error("file should not have been restored from a changed keeper")
+	}
+}
@@ -1,16 +1,20 @@
 package bloom
 
 import (
-	"crypto/md5"
 	"errors"
 )
 
 const num_slots = 5192
 const slots_per_entry = 2
 
+// Each slot is chosen by two bytes of the entry.
+const min_entry_size = slots_per_entry * 2
+
 // This Bloom filter implementation is used to maintain our week filter of
 // candidate duplicate file keys.  We assume that all entries in the filter
-// will be MD5 hashes to ensure good distribution of values.
+// will be digests from a good hash function to ensure good distribution of
+// values.  Digests of any length may be used, as long as they have at least
+// min_entry_size bytes;  only the first min_entry_size bytes are examined.
 type BloomFilter struct {
 	ar []byte
 }
@@ -27,8 +31,8 @@ func toSlot(i int, ar []byte) int {
 }
 
 func (filter *BloomFilter) Add(ar []byte) error {
-	if len(ar) != md5.Size {
-		return errors.New("not an MD5")
+	if len(ar) < min_entry_size {
+		return errors.New("digest too short")
 	}
 	for i := 0; i < slots_per_entry; i++ {
 		k := toSlot(i, ar)
@@ -38,8 +42,8 @@ func (filter *BloomFilter) Add(ar []byte) error {
 }
 
 func (filter *BloomFilter) Contains(ar []byte) (bool, error) {
-	if len(ar) != md5.Size {
-		return false, errors.New("not an MD5")
+	if len(ar) < min_entry_size {
+		return false, errors.New("digest too short")
 	}
 	for i := 0; i < slots_per_entry; i++ {
 		k := toSlot(i, ar)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/compare"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/util"
+	"path/filepath"
+)
+
+// The "compare" command:  reports which files beneath one path have a
+// copy beneath another, from the database, e.g. before an old disk is
+// retired.
+func runCompare(args []string) int {
+	flags := newFlagSet("ddet compare", "ddet compare <A> <B> [-only-a] [-v] [options]")
+	ff := addFilterFlags(flags)
+	onlyA := flags.Bool("only-a", false, "only list the files in A that have no copy in B")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	f, err := ff.filter(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if len(paths) != 2 {
+		return usageError(flags, errors.New("expected two paths"))
+	}
+	a, b := filepath.Clean(paths[0]), filepath.Clean(paths[1])
+	if util.IsWithin(a, b) || util.IsWithin(b, a) {
+		return usageError(flags, errors.New("neither path may be inside the other"))
+	}
+
+	db, err := ff.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	result, err := compare.Compare(db, a, b, f)
+	if err != nil {
+		return commandError(err)
+	}
+
+	const notCompared = "Not compared in %s, since they couldn't be told apart from files of the same length (scan both paths again, with the same -hash)"
+	printFiles(fmt.Sprintf("Only in %s", a), result.OnlyInA)
+	printFiles(fmt.Sprintf(notCompared, a), result.NotComparedInA)
+	if !*onlyA {
+		if len(result.InBoth) > 0 {
+			fmt.Printf("In both, %d files:\n", len(result.InBoth))
+			for _, m := range result.InBoth {
+				fmt.Printf("   %s = %s\n", m.File.Path, m.Copy.Path)
+			}
+		}
+		printFiles(fmt.Sprintf("Only in %s", b), result.OnlyInB)
+		printFiles(fmt.Sprintf(notCompared, b), result.NotComparedInB)
+	}
+
+	// only A's files matter to whether A can be retired
+	if len(result.OnlyInA) > 0 || len(result.NotComparedInA) > 0 {
+		return exitDuplicates
+	}
+	return exitOK
+}
+
+// Prints a heading, with the number and total size of the files, then
+// the files themselves.  Prints nothing if there are no files.
+func printFiles(heading string, entries []filedb.FileEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.Length
+	}
+	fmt.Printf("%s, %d files and %d bytes:\n", heading, len(entries), size)
+	for _, e := range entries {
+		fmt.Printf("   %s\n", e.Path)
+	}
+}
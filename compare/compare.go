@@ -0,0 +1,132 @@
+package compare
+
+import (
+	"github.com/juju/loggo"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"lostbearlabs.com/ddet/util"
+	"path/filepath"
+)
+
+var logger = loggo.GetLogger("compare")
+
+// A file beneath one root and a copy of it beneath the other.
+type Match struct {
+	File filedb.FileEntry
+	Copy filedb.FileEntry
+}
+
+// The files beneath two roots, A and B, sorted by whether the other root
+// has a copy of them.
+type Result struct {
+	// files beneath A with no copy beneath B
+	OnlyInA []filedb.FileEntry
+	// files beneath A with a copy beneath B
+	InBoth []Match
+	// files beneath B with no copy beneath A
+	OnlyInB []filedb.FileEntry
+	// files beneath A that couldn't be compared because they or B's
+	// files of the same length haven't been hashed far enough to tell
+	// them apart, or were hashed with a different algorithm
+	NotComparedInA []filedb.FileEntry
+	// files beneath B that couldn't be compared with A's, likewise
+	NotComparedInB []filedb.FileEntry
+}
+
+// The files beneath one root, in path order and by length.
+type side struct {
+	root     string
+	entries  []filedb.FileEntry
+	byLength map[int64][]filedb.FileEntry
+}
+
+// Compares the files beneath two roots, as recorded in the FileDB,
+// leaving out the files the filter doesn't match.  Files are copies if
+// they have the same hash and length, and certainly aren't if their
+// hashes, or their partial hashes, differ.
+func Compare(db *filedb.FileDB, a string, b string, f *filter.Filter) (*Result, error) {
+	sa, err := readSide(db, a, f)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := readSide(db, b, f)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	sa.match(sb, func(e filedb.FileEntry, copy *filedb.FileEntry) {
+		if copy != nil {
+			result.InBoth = append(result.InBoth, Match{e, *copy})
+		} else {
+			result.OnlyInA = append(result.OnlyInA, e)
+		}
+	}, &result.NotComparedInA)
+	sb.match(sa, func(e filedb.FileEntry, copy *filedb.FileEntry) {
+		if copy == nil {
+			result.OnlyInB = append(result.OnlyInB, e)
+		}
+	}, &result.NotComparedInB)
+
+	logger.Infof("%d files only in %s, %d in both, %d only in %s, %d and %d not compared",
+		len(result.OnlyInA), sa.root, len(result.InBoth), len(result.OnlyInB), sb.root,
+		len(result.NotComparedInA), len(result.NotComparedInB))
+	return result, nil
+}
+
+func readSide(db *filedb.FileDB, root string, f *filter.Filter) (*side, error) {
+	s := &side{root: filepath.Clean(root), byLength: make(map[int64][]filedb.FileEntry)}
+	err := db.ProcessAllFileEntries(func(e filedb.FileEntry) {
+		if !s.contains(e.Path) || !f.MatchFile(e.Path) || !f.MatchSize(e.Length) {
+			return
+		}
+		s.entries = append(s.entries, e)
+		s.byLength[e.Length] = append(s.byLength[e.Length], e)
+	}, s.root)
+	logger.Tracef("read %d files beneath %s", len(s.entries), s.root)
+	return s, err
+}
+
+// Returns true if the path is beneath the root.  The FileDB matches
+// paths by prefix, so it also returns paths beneath e.g. "/root2".
+func (s *side) contains(path string) bool {
+	return path != s.root && util.IsWithin(path, s.root)
+}
+
+// Looks for a copy of each file in the other side, calling fn with the
+// copy, or nil if there is certainly none.  The files that can't be
+// compared are added to notCompared.
+func (s *side) match(other *side, fn func(filedb.FileEntry, *filedb.FileEntry), notCompared *[]filedb.FileEntry) {
+	for _, e := range s.entries {
+		copy, certain := findCopy(e, other.byLength[e.Length])
+		if !certain {
+			*notCompared = append(*notCompared, e)
+			continue
+		}
+		fn(e, copy)
+	}
+}
+
+// Returns the copy of the entry from among the files of the same length,
+// or nil, and whether that is certain.  Files can only be told apart by
+// hashes of the same algorithm:  by their full hashes, or failing that,
+// by their partial hashes.
+func findCopy(e filedb.FileEntry, others []filedb.FileEntry) (*filedb.FileEntry, bool) {
+	certain := true
+	for i := range others {
+		o := &others[i]
+		switch {
+		case o.HashAlg != e.HashAlg:
+			certain = false
+		case e.Hash != "" && o.Hash != "":
+			if e.Hash == o.Hash {
+				return o, true
+			}
+		case e.PartialHash != "" && o.PartialHash != "" && e.PartialHash != o.PartialHash:
+			// they differ at the start or the end
+		default:
+			certain = false
+		}
+	}
+	return nil, certain
+}
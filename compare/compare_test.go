@@ -0,0 +1,131 @@
+package compare
+
+import (
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"testing"
+)
+
+func paths(entries []filedb.FileEntry) []string {
+	var result []string
+	for _, e := range entries {
+		result = append(result, e.Path)
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	file := func(path string, length int64, hash string) *filedb.FileEntry {
+		return filedb.NewTestFileEntry().SetPath(path).SetLength(length).SetHash(hash)
+	}
+	db.StoreFileEntries([]*filedb.FileEntry{
+		file("/old/both.txt", 10, "aaaa"), file("/new/renamed.txt", 10, "aaaa"),
+		file("/old/gone.txt", 20, "bbbb"), file("/new/same-length.txt", 20, "cccc"),
+		file("/old/unhashed.txt", 30, ""),
+		file("/old/unknown.txt", 40, ""), file("/new/unknown.txt", 40, ""),
+		file("/old/sha.txt", 50, "dddd"), file("/new/sha.txt", 50, "dddd").SetHashAlg("sha256"),
+		file("/new2/both.txt", 60, "eeee"), file("/old/outside.txt", 60, "eeee"),
+	})
+
+	result, err := Compare(db, "/old", "/new", filter.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(result.OnlyInA); len(got) != 3 || got[0] != "/old/gone.txt" || got[1] != "/old/outside.txt" || got[2] != "/old/unhashed.txt" {
+		t.Error("bad files only in A, got ", got)
+	}
+	if len(result.InBoth) != 1 || result.InBoth[0].File.Path != "/old/both.txt" || result.InBoth[0].Copy.Path != "/new/renamed.txt" {
+		t.Error("bad files in both, got ", result.InBoth)
+	}
+	if got := paths(result.OnlyInB); len(got) != 1 || got[0] != "/new/same-length.txt" {
+		t.Error("bad files only in B, got ", got)
+	}
+	// files of the same length, not hashed the same way
+	if got := paths(result.NotComparedInA); len(got) != 2 || got[0] != "/old/sha.txt" || got[1] != "/old/unknown.txt" {
+		t.Error("bad files not compared in A, got ", got)
+	}
+	if got := paths(result.NotComparedInB); len(got) != 2 || got[0] != "/new/sha.txt" || got[1] != "/new/unknown.txt" {
+		t.Error("bad files not compared in B, got ", got)
+	}
+}
+
+func TestCompareByPartialHash(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	file := func(path string, length int64, partial string) *filedb.FileEntry {
+		return filedb.NewTestFileEntry().SetPath(path).SetLength(length).SetHash("").SetPartialHash(partial)
+	}
+	db.StoreFileEntries([]*filedb.FileEntry{
+		file("/old/a.txt", 10, "aaaa"), file("/new/a.txt", 10, "bbbb"),
+		file("/old/b.txt", 20, "cccc"), file("/new/b.txt", 20, ""),
+		file("/old/c.txt", 30, "dddd"), file("/new/c.txt", 30, "dddd"),
+		file("/old/d.txt", 40, "eeee"), file("/new/d.txt", 40, "ffff").SetHash("ffff"),
+	})
+
+	result, err := Compare(db, "/old", "/new", filter.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// different partial hashes can't be copies, but an unhashed file
+	// can't be told apart, and nor can matching partial hashes
+	if got := paths(result.OnlyInA); len(got) != 2 || got[0] != "/old/a.txt" || got[1] != "/old/d.txt" {
+		t.Error("bad files only in A, got ", got)
+	}
+	if got := paths(result.OnlyInB); len(got) != 2 || got[0] != "/new/a.txt" || got[1] != "/new/d.txt" {
+		t.Error("bad files only in B, got ", got)
+	}
+	if got := paths(result.NotComparedInA); len(got) != 2 || got[0] != "/old/b.txt" || got[1] != "/old/c.txt" {
+		t.Error("bad files not compared in A, got ", got)
+	}
+	if got := paths(result.NotComparedInB); len(got) != 2 || got[0] != "/new/b.txt" || got[1] != "/new/c.txt" {
+		t.Error("bad files not compared in B, got ", got)
+	}
+}
+
+func TestCompareKeepsUncertainFilesInB(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	db.StoreFileEntries([]*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/old/a.txt").SetLength(10).SetHash("aaaa"),
+		filedb.NewTestFileEntry().SetPath("/new/a.txt").SetLength(10).SetHash("aaaa"),
+		filedb.NewTestFileEntry().SetPath("/new/b.txt").SetLength(10).SetHash("").SetPartialHash(""),
+	})
+
+	// every file in A has a copy, whatever B's other files are
+	result, err := Compare(db, "/old", "/new", filter.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.OnlyInA) != 0 || len(result.NotComparedInA) != 0 || len(result.InBoth) != 1 {
+		t.Error("every file in A should have a copy, got ", result)
+	}
+	if got := paths(result.NotComparedInB); len(got) != 1 || got[0] != "/new/b.txt" {
+		t.Error("bad files not compared in B, got ", got)
+	}
+}
+
+func TestCompareWithFilter(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	db.StoreFileEntries([]*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/old/a.txt"),
+		filedb.NewTestFileEntry().SetPath("/old/a.bak"),
+		filedb.NewTestFileEntry().SetPath("/new/a.bak"),
+	})
+
+	f := filter.New()
+	f.Exclude("*.bak")
+	result, err := Compare(db, "/old", "/new", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.OnlyInA) != 1 || len(result.InBoth) != 0 || len(result.OnlyInB) != 0 {
+		t.Error("a copy that the filter leaves out should not count, got ", result)
+	}
+}
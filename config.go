@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"lostbearlabs.com/ddet/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the config file a folder may have of its own.
+const projectConfigName = ".ddet.toml"
+
+// Returns the options set outside the command line for a command run on
+// a folder:  by the user's config file (or the one named by -config or
+// $DDET_CONFIG), by the folder's .ddet.toml, and by the environment, each
+// taking precedence over the one before.  The folder's file may only set
+// projectOptions.
+func loadConfig(configPath string, folder string) (*config.Config, error) {
+	c := config.New()
+
+	if configPath == "" {
+		configPath = os.Getenv(config.EnvPrefix + "CONFIG")
+	}
+	if configPath != "" {
+		user, err := config.Load(configPath)
+		if err != nil {
+			return nil, err
+		}
+		c.Merge(user)
+	} else if dir, err := os.UserConfigDir(); err == nil {
+		user, err := config.LoadIfExists(filepath.Join(dir, "ddet", "config.toml"))
+		if err != nil {
+			return nil, err
+		}
+		c.Merge(user)
+	}
+
+	if fi, err := os.Stat(folder); folder != "" && err == nil && fi.IsDir() {
+		path := filepath.Join(folder, projectConfigName)
+		project, err := config.LoadIfExists(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range project.Restrict(func(name string) bool { return projectOptions[name] }) {
+			logger.Warningf("ignoring %s in %s:  only filter and report options may be set there", name, path)
+		}
+		c.Merge(project)
+	}
+
+	c.Merge(config.FromEnv(os.Environ()))
+
+	for _, command := range c.Commands() {
+		if _, ok := commands[command]; !ok {
+			return nil, fmt.Errorf("unknown command in config: [%s]", command)
+		}
+	}
+	return c, nil
+}
+
+// The options a folder's .ddet.toml may set.  Whoever can write to a
+// folder shouldn't be able to choose where ddet writes its output, which
+// database it uses, or what it does to duplicates, so the folder may only
+// choose which files are of interest and how they are reported.
+var projectOptions = map[string]bool{
+	"exclude":       true,
+	"include":       true,
+	"min-size":      true,
+	"max-size":      true,
+	"gitignore":     true,
+	"no-ddetignore": true,
+	"verify":        true,
+	"keep":          true,
+	"explain":       true,
+	"format":        true,
+	"S":             true,
+	"1":             true,
+	"cross-root":    true,
+	"files":         true,
+	"similar":       true,
+	"only-a":        true,
+	"l":             true,
+	"csv":           true,
+	"v":             true,
+}
+
+// Options that are only taken from the command line, either for every
+// command or, as "command.option", for one.  The -hash of lookup names a
+// digest rather than the algorithm that scans use.
+var commandLineOnly = map[string]bool{
+	"config":      true,
+	"lookup.hash": true,
+	"lookup.size": true,
+}
+
+// Sets the flags that weren't given on the command line from the
+// config.  Options the command doesn't have are ignored, since they may
+// be meant for other commands.  A list option, like -exclude, may be set
+// from a single string of values separated by commas.
+func applyConfig(flags *flag.FlagSet, c *config.Config) error {
+	command := strings.TrimPrefix(flags.Name(), "ddet ")
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] || commandLineOnly[f.Name] || commandLineOnly[command+"."+f.Name] {
+			return
+		}
+		s, ok := c.Lookup(command, f.Name)
+		if !ok {
+			return
+		}
+		values := s.Values
+		if _, isList := f.Value.(*stringList); isList {
+			if !s.List {
+				values = strings.Split(values[0], ",")
+			}
+		} else if len(values) != 1 {
+			err = fmt.Errorf("option %s from %s takes a single value", f.Name, s.Source)
+			return
+		}
+		for _, value := range values {
+			if setErr := flags.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("bad value for option %s from %s: %v", f.Name, s.Source, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// The "config" command:  shows the options that config files and the
+// environment set, merged together.
+func runConfig(args []string) int {
+	flags := newFlagSet("ddet config", "ddet config show [folder] [-config FILE] [-v]")
+	cf := addCommonFlags(flags)
+
+	// not parseArgs(), which would take "show" for the folder
+	paths, err := parseCommandLine(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	setLogging(*cf.verbose)
+	if len(paths) == 0 || paths[0] != "show" || len(paths) > 2 {
+		return usageError(flags, errors.New("expected show, and optionally a folder"))
+	}
+	folder := ""
+	if len(paths) == 2 {
+		folder = paths[1]
+	}
+
+	c, err := loadConfig(*cf.configPath, folder)
+	if err != nil {
+		return commandError(err)
+	}
+	err = c.Write(os.Stdout)
+	if err != nil {
+		return commandError(err)
+	}
+	return exitOK
+}
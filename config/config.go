@@ -0,0 +1,263 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/juju/loggo"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var logger = loggo.GetLogger("config")
+
+// The prefix of the environment variables that set options, e.g.
+// DDET_MIN_SIZE for min-size.
+const EnvPrefix = "DDET_"
+
+// The value of one option, and where it came from.
+type Setting struct {
+	// the value as text, as it would be given on the command line; an
+	// option that may be repeated can have several
+	Values []string
+	// true if the value was a list, rather than a single value
+	List bool
+	// the file or environment variable that set the option
+	Source string
+	// the value as it would be written in a TOML file
+	text string
+}
+
+// Option values by name, where the names are those of the command line
+// flags, e.g. "min-size".  Options may be set for every command, or for
+// a single command, which takes precedence.
+type Config struct {
+	settings map[string]Setting
+	commands map[string]map[string]Setting
+}
+
+func New() *Config {
+	return &Config{settings: make(map[string]Setting), commands: make(map[string]map[string]Setting)}
+}
+
+// Reads a TOML file.  Its top-level keys set options for every command,
+// and its tables, named after commands, set options for just that
+// command, e.g.:
+//
+//	exclude = [".git", "node_modules"]
+//	min-size = "1M"
+//
+//	[dedupe]
+//	action = "quarantine"
+func Load(path string) (*Config, error) {
+	var doc map[string]interface{}
+	_, err := toml.DecodeFile(path, &doc)
+	if err != nil {
+		return nil, err
+	}
+	logger.Tracef("read config file %s", path)
+
+	c := New()
+	for key, value := range doc {
+		if table, ok := value.(map[string]interface{}); ok {
+			settings := make(map[string]Setting)
+			for name, value := range table {
+				s, err := newSetting(value, path)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s.%s: %v", path, key, name, err)
+				}
+				settings[name] = s
+			}
+			c.commands[key] = settings
+			continue
+		}
+		s, err := newSetting(value, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, key, err)
+		}
+		c.settings[key] = s
+	}
+	return c, nil
+}
+
+// Like Load(), but returns an empty Config if the file doesn't exist.
+func LoadIfExists(path string) (*Config, error) {
+	c, err := Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(), nil
+	}
+	return c, err
+}
+
+// Returns the options set by environment variables, given as
+// "NAME=value" strings like those from os.Environ().  Each variable
+// starting with EnvPrefix sets the option named by the rest of it, in
+// lower case and with underscores for dashes.
+func FromEnv(environ []string) *Config {
+	c := New()
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv[:i], EnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.Replace(kv[len(EnvPrefix):i], "_", "-", -1))
+		value := kv[i+1:]
+		c.settings[name] = Setting{Values: []string{value}, Source: "$" + kv[:i], text: strconv.Quote(value)}
+	}
+	return c
+}
+
+func newSetting(value interface{}, source string) (Setting, error) {
+	items, list := value.([]interface{})
+	if !list {
+		items = []interface{}{value}
+	}
+
+	s := Setting{List: list, Source: source}
+	var texts []string
+	for _, item := range items {
+		var value, text string
+		switch v := item.(type) {
+		case string:
+			value, text = v, strconv.Quote(v)
+		case bool:
+			value = strconv.FormatBool(v)
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case float64:
+			value = strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			return s, fmt.Errorf("unsupported value %v", item)
+		}
+		if text == "" {
+			text = value
+		}
+		s.Values = append(s.Values, value)
+		texts = append(texts, text)
+	}
+
+	s.text = strings.Join(texts, ", ")
+	if list {
+		s.text = "[" + s.text + "]"
+	}
+	return s, nil
+}
+
+// Adds the options from another Config, which take precedence over
+// these.  An option the other Config sets for every command also
+// replaces the one these set for a single command, so that each Config
+// overrides the last in turn, whatever the table.
+func (c *Config) Merge(other *Config) {
+	for name, s := range other.settings {
+		c.settings[name] = s
+		for _, settings := range c.commands {
+			delete(settings, name)
+		}
+	}
+	for command, settings := range other.commands {
+		if c.commands[command] == nil {
+			c.commands[command] = make(map[string]Setting)
+		}
+		for name, s := range settings {
+			c.commands[command][name] = s
+		}
+	}
+}
+
+// Removes the options that allowed rejects, returning their names in
+// sorted order, as "command.option" for those set for a single command.
+func (c *Config) Restrict(allowed func(name string) bool) []string {
+	var removed []string
+	for name := range c.settings {
+		if !allowed(name) {
+			delete(c.settings, name)
+			removed = append(removed, name)
+		}
+	}
+	for command, settings := range c.commands {
+		for name := range settings {
+			if !allowed(name) {
+				delete(settings, name)
+				removed = append(removed, command+"."+name)
+			}
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// Returns the setting for an option of a command:  the one set for the
+// command, if any, or else the one set for every command.  Within a
+// single Config, the one set for the command takes precedence;  see
+// Merge() for how Configs combine.
+func (c *Config) Lookup(command string, name string) (Setting, bool) {
+	if s, ok := c.commands[command][name]; ok {
+		return s, true
+	}
+	s, ok := c.settings[name]
+	return s, ok
+}
+
+// Returns the names of the commands that have options of their own, in
+// sorted order.
+func (c *Config) Commands() []string {
+	commands := make([]string, 0, len(c.commands))
+	for command := range c.commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// Writes the options as a TOML file, noting where each came from.
+func (c *Config) Write(w io.Writer) error {
+	err := writeSettings(w, c.settings)
+	if err != nil {
+		return err
+	}
+	for _, command := range c.Commands() {
+		if len(c.commands[command]) == 0 {
+			// every option was overridden for all commands
+			continue
+		}
+		_, err = fmt.Fprintf(w, "\n[%s]\n", command)
+		if err != nil {
+			return err
+		}
+		err = writeSettings(w, c.commands[command])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSettings(w io.Writer, settings map[string]Setting) error {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := settings[name]
+		_, err := fmt.Fprintf(w, "%s = %s  # from %s\n", tomlKey(name), s.text, s.Source)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quotes a key if TOML requires it, e.g. for an option set by an
+// environment variable with an odd name.
+func tomlKey(name string) string {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
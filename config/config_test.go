@@ -0,0 +1,156 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, text string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.toml")
+	err = ioutil.WriteFile(path, []byte(text), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfigFile(t, `
+exclude = [".git", "node_modules"]
+min-size = "1M"
+verify = true
+hash-workers = 4
+
+[dedupe]
+action = "quarantine"
+`)
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, ok := c.Lookup("report", "exclude")
+	if !ok || !s.List || !reflect.DeepEqual(s.Values, []string{".git", "node_modules"}) || s.Source != path {
+		t.Error("bad exclude, got ", s)
+	}
+	for name, want := range map[string]string{"min-size": "1M", "verify": "true", "hash-workers": "4"} {
+		s, ok := c.Lookup("scan", name)
+		if !ok || s.List || len(s.Values) != 1 || s.Values[0] != want {
+			t.Error("bad ", name, ", got ", s)
+		}
+	}
+	if s, ok := c.Lookup("dedupe", "action"); !ok || s.Values[0] != "quarantine" {
+		t.Error("bad dedupe action, got ", s)
+	}
+	if _, ok := c.Lookup("script", "action"); ok {
+		t.Error("dedupe's action should not apply to script")
+	}
+	if !reflect.DeepEqual(c.Commands(), []string{"dedupe"}) {
+		t.Error("bad commands, got ", c.Commands())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load(writeConfigFile(t, "exclude = [\n"))
+	if err == nil {
+		t.Error("should have failed to parse")
+	}
+	_, err = Load(writeConfigFile(t, "when = 2024-01-01T00:00:00Z\n"))
+	if err == nil {
+		t.Error("should have rejected a date")
+	}
+	_, err = Load("/no/such/config.toml")
+	if err == nil {
+		t.Error("should have failed to read")
+	}
+	c, err := LoadIfExists("/no/such/config.toml")
+	if err != nil || len(c.settings) != 0 {
+		t.Error("missing file should give an empty config, got ", c, err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	c := FromEnv([]string{"HOME=/root", "DDET_MIN_SIZE=2G", "DDET_DB=:memory:"})
+	if s, ok := c.Lookup("scan", "min-size"); !ok || s.Values[0] != "2G" || s.Source != "$DDET_MIN_SIZE" {
+		t.Error("bad min-size, got ", s)
+	}
+	if s, ok := c.Lookup("scan", "db"); !ok || s.Values[0] != ":memory:" {
+		t.Error("bad db, got ", s)
+	}
+	if _, ok := c.Lookup("scan", "home"); ok {
+		t.Error("should only use DDET_ variables")
+	}
+}
+
+func TestMergeAndWrite(t *testing.T) {
+	user, _ := Load(writeConfigFile(t, "min-size = \"1M\"\nhash = \"md5\"\n[report]\nformat = \"json\"\n"))
+	project, _ := Load(writeConfigFile(t, "hash = \"blake3\"\nkeep = [\"oldest\"]\n"))
+	c := New()
+	c.Merge(user)
+	c.Merge(project)
+	c.Merge(FromEnv([]string{"DDET_MIN_SIZE=2G"}))
+
+	var b strings.Builder
+	err := c.Write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	if len(lines) != 7 ||
+		!strings.HasPrefix(lines[0], `hash = "blake3"  # from `) ||
+		!strings.HasPrefix(lines[1], `keep = ["oldest"]  # from `) ||
+		lines[2] != `min-size = "2G"  # from $DDET_MIN_SIZE` ||
+		lines[4] != "[report]" ||
+		!strings.HasPrefix(lines[5], `format = "json"  # from `) {
+		t.Error("bad config, got ", b.String())
+	}
+}
+
+func TestMergeOverridesCommandTables(t *testing.T) {
+	user, _ := Load(writeConfigFile(t, "[report]\nformat = \"json\"\n[dedupe]\naction = \"delete\"\n"))
+	project, _ := Load(writeConfigFile(t, "action = \"quarantine\"\n[report]\nverify = true\n"))
+	c := New()
+	c.Merge(user)
+	c.Merge(project)
+	c.Merge(FromEnv([]string{"DDET_FORMAT=csv"}))
+
+	// later layers win, even over an earlier layer's command tables
+	if s, _ := c.Lookup("report", "format"); s.Values[0] != "csv" {
+		t.Error("the environment should override the user file, got ", s)
+	}
+	if s, _ := c.Lookup("dedupe", "action"); s.Values[0] != "quarantine" {
+		t.Error("the project file should override the user file, got ", s)
+	}
+	if s, _ := c.Lookup("report", "verify"); s.Values[0] != "true" {
+		t.Error("wrong value from the project file, got ", s)
+	}
+
+	var b strings.Builder
+	c.Write(&b)
+	if strings.Contains(b.String(), "json") || strings.Contains(b.String(), "[dedupe]") {
+		t.Error("overridden options should not be shown, got ", b.String())
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	c, _ := Load(writeConfigFile(t, "exclude = [\"tmp\"]\ndb = \"/tmp/other.db\"\n[script]\no = \"/tmp/x.sh\"\nformat = \"json\"\n"))
+	removed := c.Restrict(func(name string) bool { return name == "exclude" || name == "format" })
+	if len(removed) != 2 || removed[0] != "db" || removed[1] != "script.o" {
+		t.Error("wrong options removed, got ", removed)
+	}
+	if _, ok := c.Lookup("script", "o"); ok {
+		t.Error("the option should have been removed")
+	}
+	if s, ok := c.Lookup("script", "format"); !ok || s.Values[0] != "json" {
+		t.Error("the allowed option should have been kept, got ", s)
+	}
+}
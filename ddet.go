@@ -1,83 +1,609 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/juju/loggo"
+	"io"
 	"lostbearlabs.com/ddet/dset"
 	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"lostbearlabs.com/ddet/hashing"
+	"lostbearlabs.com/ddet/keep"
+	"lostbearlabs.com/ddet/report"
 	"lostbearlabs.com/ddet/scanner"
 	"lostbearlabs.com/ddet/util"
+	"lostbearlabs.com/ddet/verify"
 	"os"
 	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
 var logger loggo.Logger = loggo.GetLogger("ddet.main")
 
+// Exit codes.  Commands that report duplicates exit with exitDuplicates
+// if they find any, as does lookup if it finds a copy of anything looked
+// up, and compare if A has a file with no known copy in B;  every command
+// exits with exitError if it fails, or if its command line is bad.
+const (
+	exitOK         = 0
+	exitDuplicates = 1
+	exitError      = 2
+)
+
 func main() {
-	path := ""
-	numPaths := 0
-	verbose := false
-
-	for n, arg := range os.Args {
-		if n > 0 {
-			switch arg {
-			case "-v":
-				verbose = true
-			default:
-				path = arg
-				numPaths++
-			}
-		}
+	os.Exit(run(os.Args[1:]))
+}
+
+// Runs the command selected by the first argument.  Without a command,
+// the arguments name a folder to scan and then report on, as they did
+// before there were commands.
+func run(args []string) int {
+	if len(args) == 0 {
+		printCommands()
+		return exitError
+	}
+	if c, ok := commands[args[0]]; ok {
+		return c.run(args[1:])
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		return runHelp(args[1:])
+	}
+	return runScanAndReport(args)
+}
+
+type command struct {
+	run func(args []string) int
+	// a one-line description, for the list of commands
+	summary string
+}
+
+// The commands, selected by the first argument.  Set up by init(), since
+// some commands refer to the list of commands.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"scan":    {runScan, "scan a folder into the database, without reporting on it"},
+		"report":  {runReport, "report the duplicates beneath a path, from the database"},
+		"link":    {runLink, "scan a folder, then replace duplicates with hardlinks"},
+		"dedupe":  {runDedupe, "scan a folder, then delete or quarantine duplicates"},
+		"undo":    {runUndo, "restore the files removed by a dedupe"},
+		"script":  {runScript, "scan a folder, then write a shell script that acts on duplicates"},
+		"query":   {runQuery, "list the files in the database beneath a path"},
+		"stats":   {runStats, "show statistics about the files in the database beneath a path"},
+		"prune":   {runPrune, "remove database entries for files that no longer exist"},
+		"export":  {runExport, "write the database entries beneath a path as CSV"},
+		"import":  {runImport, "read database entries written by export"},
+		"dirs":    {runDirs, "report the directories beneath a path that are copies of each other"},
+		"compare": {runCompare, "report which files beneath one path have no copy beneath another"},
+		"lookup":  {runLookup, "report whether the database has copies of some files, or of a hash"},
+		"config":  {runConfig, "show the options set by config files and the environment"},
+	}
+}
+
+func printCommands() {
+	fmt.Printf("Usage:\n")
+	fmt.Printf("   ddet <command> [arguments]\n")
+	fmt.Printf("   ddet <folder> [options]   (scan the folder, then report on it)\n")
+	fmt.Printf("\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("   %-8s %s\n", name, commands[name].summary)
+	}
+	fmt.Printf("\nRun \"ddet help <command>\" for the options of a command.\n")
+}
+
+// The "help" command:  lists the commands, or shows the usage of one.
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		printCommands()
+		return exitOK
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		fmt.Printf("Error: unknown command: %s\n", args[0])
+		printCommands()
+		return exitError
+	}
+	return c.run([]string{"-h"})
+}
+
+// Returns the exit code for a command line that could not be parsed.
+// Asking for help is not an error.
+func parseFailure(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	return exitError
+}
+
+// Prints an error along with the usage of the command, for a bad
+// command line.
+func usageError(flags *flag.FlagSet, err error) int {
+	fmt.Printf("Error: %v\n", err)
+	flags.Usage()
+	return exitError
+}
+
+// Prints an error that stopped a command.
+func commandError(err error) int {
+	fmt.Printf("Error: %v\n", err)
+	return exitError
+}
+
+// The flags shared by every command.
+type commonFlags struct {
+	verbose    *bool
+	dbPath     *string
+	configPath *string
+}
+
+func addCommonFlags(flags *flag.FlagSet) *commonFlags {
+	cf := &commonFlags{}
+	cf.verbose = flags.Bool("v", false, "verbose logging")
+	cf.dbPath = flags.String("db", "", "database file, or "+filedb.MemoryPath+" for one that is thrown away on exit (default ddet/ddet.db in the user cache folder)")
+	cf.configPath = flags.String("config", "", "config file to read instead of ddet/config.toml in the user config folder")
+	return cf
+}
+
+// The flags shared by every command that filters the files it looks at.
+type filterFlags struct {
+	*commonFlags
+	excludes stringList
+	includes stringList
+	minSize  *string
+	maxSize  *string
+}
+
+func addFilterFlags(flags *flag.FlagSet) *filterFlags {
+	ff := &filterFlags{commonFlags: addCommonFlags(flags)}
+	flags.Var(&ff.excludes, "exclude", "glob pattern for paths to leave out (may be repeated)")
+	flags.Var(&ff.includes, "include", "glob pattern for paths to keep, leaving out all others (may be repeated)")
+	ff.minSize = flags.String("min-size", "", "leave out files smaller than this, e.g. 64K, 1M, 2G")
+	ff.maxSize = flags.String("max-size", "", "leave out files larger than this, e.g. 64K, 1M, 2G")
+	return ff
+}
+
+// Sets up logging and returns the filter selected by the parsed flags,
+// for the roots.
+func (ff *filterFlags) filter(roots ...string) (*filter.Filter, error) {
+	setLogging(*ff.verbose)
+	f, err := makeFilter(ff.excludes, ff.includes, *ff.minSize, *ff.maxSize)
+	if err != nil {
+		return nil, err
 	}
+	f.SetRoots(roots...)
+	return f, nil
+}
+
+// The flags shared by every command that scans a folder.
+type scanFlags struct {
+	*filterFlags
+	opts         scanner.Options
+	gitignore    *bool
+	noDdetignore *bool
+	hashName     *string
+}
+
+func addScanFlags(flags *flag.FlagSet) *scanFlags {
+	sf := &scanFlags{filterFlags: addFilterFlags(flags), opts: scanner.DefaultOptions()}
+	opts := &sf.opts
+	flags.IntVar(&opts.StatWorkers, "stat-workers", opts.StatWorkers, "number of files to stat and look up in the database at once")
+	flags.IntVar(&opts.HashWorkers, "hash-workers", opts.HashWorkers, "number of files to read and hash at once")
+	flags.IntVar(&opts.QueueSize, "queue-size", opts.QueueSize, "number of files queued between scan stages")
+	flags.IntVar(&opts.BatchSize, "batch-size", opts.BatchSize, "maximum number of files committed to the database at once")
+	flags.DurationVar(&opts.BatchInterval, "batch-interval", opts.BatchInterval, "maximum time between database commits")
+	sf.gitignore = flags.Bool("gitignore", false, "also honor .gitignore files")
+	sf.noDdetignore = flags.Bool("no-ddetignore", false, "do not honor .ddetignore files")
+	sf.hashName = flags.String("hash", opts.Hasher.Name(), "hash algorithm, one of: "+strings.Join(hashing.Names(), ", "))
+	return sf
+}
 
+// Sets up logging and returns the scanner options selected by the
+// parsed flags, for scanning the roots.
+func (sf *scanFlags) options(roots ...string) (scanner.Options, error) {
+	opts := sf.opts
+	var err error
+	opts.Filter, err = sf.filter(roots...)
+	if err != nil {
+		return opts, err
+	}
+
+	if opts.StatWorkers < 1 || opts.HashWorkers < 1 || opts.QueueSize < 1 || opts.BatchSize < 1 || opts.BatchInterval <= 0 {
+		return opts, fmt.Errorf("worker, queue, and batch sizes must be positive")
+	}
+
+	hasher, err := hashing.Lookup(*sf.hashName)
+	if err != nil {
+		return opts, err
+	}
+	opts.Hasher = hasher
+
+	opts.IgnoreFiles = nil
+	if !*sf.noDdetignore {
+		opts.IgnoreFiles = append(opts.IgnoreFiles, filter.DdetIgnore)
+	}
+	if *sf.gitignore {
+		opts.IgnoreFiles = append(opts.IgnoreFiles, filter.GitIgnore)
+	}
+	return opts, nil
+}
+
+// The flags shared by every command that reports duplicates.
+type reportFlags struct {
+	*keepFlags
+	verify    *bool
+	format    *string
+	showSize  *bool
+	sameLine  *bool
+	crossRoot *bool
+}
+
+func addReportFlags(flags *flag.FlagSet) *reportFlags {
+	rf := &reportFlags{}
+	rf.verify = flags.Bool("verify", false, "compare the contents of duplicate files byte-for-byte before reporting them")
+	rf.keepFlags = addKeepFlags(flags)
+	rf.format = flags.String("format", "text", "report format, one of: "+strings.Join(report.Formats(), ", "))
+	rf.showSize = flags.Bool("S", false, "for -format fdupes, show the size of the files in each group")
+	rf.sameLine = flags.Bool("1", false, "for -format fdupes, write each group on one line")
+	rf.crossRoot = flags.Bool("cross-root", false, "given several folders, only report groups with files in more than one")
+	return rf
+}
+
+// Returns the report options selected by the parsed flags, for
+// reporting on the roots.
+func (rf *reportFlags) options(roots ...string) (reportOptions, error) {
+	rules, err := rf.rules(roots...)
+	if err != nil {
+		return reportOptions{}, err
+	}
+	if _, err := report.New(*rf.format, nil, report.Options{}); err != nil {
+		return reportOptions{}, err
+	}
+	return reportOptions{
+		verify:    *rf.verify,
+		rules:     rules,
+		format:    *rf.format,
+		opts:      report.Options{Explain: *rf.explain, ShowSize: *rf.showSize, SameLine: *rf.sameLine},
+		out:       os.Stdout,
+		crossRoot: *rf.crossRoot,
+	}, nil
+}
+
+func setLogging(verbose bool) {
 	if verbose {
 		util.SetLogTrace()
 	} else {
 		util.SetLogInfo()
 	}
+}
 
-	if numPaths != 1 {
+// Creates the flag set for a command.  Usage goes to stdout, along with
+// the rest of our output.
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
 		fmt.Printf("Usage:\n")
-		fmt.Printf("   ddet <folder> [-v]\n")
-		return
+		fmt.Printf("   %s\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// The default command:  scans one or more folders and reports the
+// duplicates in them.
+func runScanAndReport(args []string) int {
+	flags := newFlagSet("ddet", "ddet <folder>... [-cross-root] [-v] [options]")
+	sf := addScanFlags(flags)
+	rf := addReportFlags(flags)
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	opts, err := sf.options(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	ro, err := rf.options(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if err := checkRoots(paths, ro); err != nil {
+		return usageError(flags, err)
 	}
 
-	doScan(path)
+	db, err := sf.openFoldersAndDB(paths...)
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	scanned, err := scanFiles(paths, db, opts)
+	if err != nil {
+		return commandError(err)
+	}
+	return reportExitCode(analyzeDuplicates(db, paths, opts.Filter, ro, &scanned))
 }
 
-func doScan(path string) {
-	fi, err := os.Stat(path)
+// The "scan" command:  scans one or more folders into the database, so
+// that they can be reported on later.
+func runScan(args []string) int {
+	flags := newFlagSet("ddet scan", "ddet scan <folder>... [-v] [options]")
+	sf := addScanFlags(flags)
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	opts, err := sf.options(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if err := checkRoots(paths, reportOptions{}); err != nil {
+		return usageError(flags, err)
+	}
+
+	db, err := sf.openFoldersAndDB(paths...)
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	_, err = scanFiles(paths, db, opts)
+	if err != nil {
+		return commandError(err)
+	}
+	return exitOK
+}
+
+// Returns the exit code for a report:  whether it found duplicates, or
+// failed.
+func reportExitCode(summary report.Summary, err error) int {
+	switch {
+	case err != nil:
+		return commandError(err)
+	case summary.Groups > 0:
+		return exitDuplicates
+	default:
+		return exitOK
+	}
+}
+
+// How the duplicates found by a scan are reported.
+type reportOptions struct {
+	// compare the files in each group byte-for-byte first
+	verify bool
+	// the rules for choosing the file to keep from each group
+	rules []keep.Rule
+	// the report format, e.g. text or json, and its options
+	format string
+	opts   report.Options
+	// where the report is written
+	out io.Writer
+	// if set, groups for which this returns true are left out
+	omit func(entries []filedb.FileEntry) bool
+	// the folders analyzed;  when there are several, each file is
+	// annotated with the one it is in
+	roots []string
+	// only report groups with files in more than one of the roots
+	crossRoot bool
+}
+
+// A flag value that may be repeated, collecting every value given.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func makeFilter(excludes []string, includes []string, minSize string, maxSize string) (*filter.Filter, error) {
+	f := filter.New()
+	var min, max int64
+	var err error
+	if minSize != "" {
+		min, err = filter.ParseSize(minSize)
+		if err != nil {
+			return nil, err
+		}
+		f.SetMinSize(min)
+	}
+	if maxSize != "" {
+		max, err = filter.ParseSize(maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if max == 0 || max < min {
+			return nil, fmt.Errorf("bad max size: %s", maxSize)
+		}
+		f.SetMaxSize(max)
+	}
+	for _, glob := range excludes {
+		if err := f.Exclude(glob); err != nil {
+			return nil, fmt.Errorf("bad exclude pattern %q: %v", glob, err)
+		}
+	}
+	for _, glob := range includes {
+		if err := f.Include(glob); err != nil {
+			return nil, fmt.Errorf("bad include pattern %q: %v", glob, err)
+		}
+	}
+	return f, nil
+}
+
+// Parses the command line, allowing flags to appear after the folder
+// as well as before it, then sets any flags it didn't give from config
+// files and the environment.  Returns the non-flag arguments, made
+// absolute and clean.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional, err := parseCommandLine(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range positional {
+		if p == "-" {
+			continue
+		}
+		// Abs also cleans the path, so "." and "./d/" match the
+		// absolute, clean paths stored in the database.
+		if positional[i], err = filepath.Abs(p); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return nil, err
+		}
+	}
+
+	configPath := ""
+	if f := flags.Lookup("config"); f != nil {
+		configPath = f.Value.String()
+	}
+	folder := ""
+	if len(positional) > 0 {
+		folder = positional[0]
+	}
+	c, err := loadConfig(configPath, folder)
+	if err == nil {
+		err = applyConfig(flags, c)
+	}
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
-		return
+		return nil, err
 	}
-	if !fi.IsDir() {
-		fmt.Printf("Not a directory: %s\n", path)
-		return
+	return positional, nil
+}
+
+func parseCommandLine(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
+}
 
-	user, err := user.Current()
+// Checks that the paths are folders we can scan, then opens the
+// database.
+func (cf *commonFlags) openFoldersAndDB(paths ...string) (*filedb.FileDB, error) {
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("not a directory: %s", path)
+		}
+	}
+	return cf.openDB()
+}
+
+// Checks the folders to be analyzed together:  there must be at least
+// one, none may be inside another, and -cross-root needs more than one.
+func checkRoots(paths []string, ro reportOptions) error {
+	if len(paths) == 0 {
+		return errors.New("expected at least one folder")
+	}
+	for i, a := range paths {
+		for _, b := range paths[i+1:] {
+			if util.IsWithin(filepath.Clean(a), filepath.Clean(b)) || util.IsWithin(filepath.Clean(b), filepath.Clean(a)) {
+				return fmt.Errorf("folders may not be inside one another: %s, %s", a, b)
+			}
+		}
+	}
+	if ro.crossRoot && len(paths) < 2 {
+		return errors.New("-cross-root needs more than one folder")
+	}
+	return nil
+}
+
+// Returns the root the path is in, or "" if it is in none of them.
+func rootOf(path string, roots []string) string {
+	for _, root := range roots {
+		if util.IsWithin(path, filepath.Clean(root)) {
+			return root
+		}
+	}
+	return ""
+}
+
+// Opens the database named by -db, or else the default one.
+func (cf *commonFlags) openDB() (*filedb.FileDB, error) {
+	dbPath := *cf.dbPath
+	if dbPath == "" {
+		var err error
+		dbPath, err = defaultDBPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	logger.Tracef("using database %s", dbPath)
+
+	db, err := filedb.InitDB(dbPath)
 	if err != nil {
-		fmt.Printf("Error getting current user: %v\n", err)
-		return
+		return nil, fmt.Errorf("unable to open database %s: %v", dbPath, err)
 	}
-	dbpath := user.HomeDir + "/.ddetdb"
+	return db, nil
+}
 
-	db, err := filedb.InitDB(dbpath)
+// Returns the path of the default database, ddet/ddet.db in the user's
+// cache folder (e.g. $XDG_CACHE_HOME), creating the folder if need be.
+// A database left in ~/.ddetdb by an older version is used instead if
+// there is no database in the cache folder yet, so that its hashes
+// aren't lost.
+func defaultDBPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
 	if err != nil {
-		fmt.Printf("Error opening ~/.ddetdb: %v", err)
-		return
+		return "", fmt.Errorf("unable to find the user cache folder, use -db or $DDET_DB: %v", err)
 	}
-	defer db.Close()
+	dbPath := filepath.Join(cacheDir, "ddet", "ddet.db")
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		if home, err := homeDir(); err == nil {
+			legacyPath := filepath.Join(home, ".ddetdb")
+			if _, err := os.Stat(legacyPath); err == nil {
+				return legacyPath, nil
+			}
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(dbPath), 0755)
+	if err != nil {
+		return "", err
+	}
+	return dbPath, nil
+}
 
-	scanFiles(path, db)
-	analyzeDuplicates(db, path)
+func homeDir() (string, error) {
+	user, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("unable to get current user: %v", err)
+	}
+	return user.HomeDir, nil
 }
 
-func scanFiles(path string, db *filedb.FileDB) {
-	logger.Tracef("BEGIN SCAN: %s", path)
-	scanner := scanner.MakeScanner(db)
+// Scans the folders into the database together, printing progress as
+// it goes.
+func scanFiles(paths []string, db *filedb.FileDB, opts scanner.Options) (scanner.Summary, error) {
+	logger.Tracef("BEGIN SCAN: %s", strings.Join(paths, ", "))
+	scanner := scanner.MakeScanner(db, opts)
 
 	// while scanning, print progress once per second
 	ticker := time.NewTicker(time.Second * 1)
@@ -88,46 +614,137 @@ func scanFiles(path string, db *filedb.FileDB) {
 	}()
 
 	// run the scanner, populate the database
-	err := scanner.ScanFiles(path)
+	err := scanner.ScanFiles(paths...)
+	ticker.Stop()
 	if err != nil {
-		panic(err)
+		return scanner.Summary(), err
 	}
 
 	// print scan results
-	ticker.Stop()
 	scanner.PrintSummary(true)
-	logger.Infof("COMPLETED SCAN: %s\n", path)
-
+	logger.Infof("COMPLETED SCAN: %s\n", strings.Join(paths, ", "))
+	return scanner.Summary(), nil
 }
 
-func analyzeDuplicates(db *filedb.FileDB, path string) {
+// Finds the keys of the duplicate files under the paths, taken together.
+func findDuplicates(db *filedb.FileDB, paths []string, f *filter.Filter) (*dset.KnownFileSet, []dset.KnownFileKey) {
 	logger.Tracef("BEGIN ANALYSIS")
 	start := time.Now()
 
 	// process file entries from the database
 	ks := dset.New()
-	ks.AddAll(db, path)
+	ks.SetFilter(f)
+	ks.AddAll(db, paths...)
 	dupKeys := ks.GetDuplicateKeys()
 	logger.Infof("COMPLETED ANALYSIS, elapsed=%v\n", time.Since(start))
+	return ks, dupKeys
+}
 
-	// print results
+// Reports the duplicates under the paths, taken together.  The summary
+// of the scan that preceded the analysis, if any, is included in the
+// report.  Returns the totals over the report.
+func analyzeDuplicates(db *filedb.FileDB, paths []string, f *filter.Filter, ro reportOptions, scanned *scanner.Summary) (report.Summary, error) {
+	ks, dupKeys := findDuplicates(db, paths, f)
+	ro.roots = paths
 
 	if dupKeys == nil || len(dupKeys) == 0 {
 		logger.Infof("NO DUPLICATES FOUND, %d files total\n", ks.GetNumFiles())
-		return
+	} else {
+		logger.Infof("found %d groups of duplicate files, %d files total", len(dupKeys), ks.GetNumFiles())
 	}
 
-	logger.Infof("found %d groups of duplicate files, %d files total", len(dupKeys), ks.GetNumFiles())
+	reporter, err := report.New(ro.format, ro.out, ro.opts)
+	if err != nil {
+		return report.Summary{}, err
+	}
+	summary := report.Summary{
+		Files:    int(ks.GetNumFiles()),
+		Verified: ro.verify,
+	}
+	if scanned != nil {
+		summary.Scan = &report.ScanSummary{
+			FilesFound:           scanned.FilesFound,
+			FilesAdded:           scanned.FilesAdded,
+			FilesChanged:         scanned.FilesUpdated,
+			FilesDeleted:         scanned.FilesDeleted,
+			FilesPartiallyHashed: scanned.FilesPartiallyHashed,
+			FilesFullyHashed:     scanned.FilesFullyHashed,
+		}
+	}
 
+	err = writeReport(reporter, &summary, db, ks, dupKeys, paths, ro)
+	if err != nil {
+		return summary, fmt.Errorf("unable to write report: %v", err)
+	}
+	return summary, nil
+}
+
+func writeReport(reporter report.Reporter, summary *report.Summary, db *filedb.FileDB, ks *dset.KnownFileSet, dupKeys []dset.KnownFileKey, paths []string, ro reportOptions) error {
+	err := reporter.Begin(paths)
+	if err != nil {
+		return err
+	}
 	for _, key := range dupKeys {
 		entries, err := ks.GetFileEntries(db, key)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		fmt.Printf("Files with MD5 %s and length %d:\n", entries[0].Md5, entries[0].Length)
-		for _, entry := range entries {
-			fmt.Printf("   %s\n", entry.Path)
+		// copies outside the folders are neither kept nor reported
+		entries = dset.EntriesWithin(entries, paths...)
+		if len(entries) < 2 {
+			continue
 		}
+		err = reportDuplicates(reporter, summary, entries, ro)
+		if err != nil {
+			return err
+		}
+	}
+	return reporter.End(*summary)
+}
+
+// Reports the files sharing a key.  Given ro.verify, the files are
+// compared byte-for-byte first:  files that turn out to be identical
+// are reported as groups, and any others as unverified.
+func reportDuplicates(reporter report.Reporter, summary *report.Summary, entries []filedb.FileEntry, ro reportOptions) error {
+	if !ro.verify {
+		return reportGroup(reporter, summary, entries, ro)
 	}
 
+	result := verify.Group(entries)
+	for _, identical := range result.Identical {
+		err := reportGroup(reporter, summary, identical, ro)
+		if err != nil {
+			return err
+		}
+	}
+	if unverified, ok := report.NewUnverified(result); ok {
+		summary.AddUnverified(unverified)
+		return reporter.Unverified(unverified)
+	}
+	return nil
+}
+
+func reportGroup(reporter report.Reporter, summary *report.Summary, entries []filedb.FileEntry, ro reportOptions) error {
+	if ro.omit != nil && ro.omit(entries) {
+		return nil
+	}
+	if ro.crossRoot {
+		roots := make(map[string]bool)
+		for _, entry := range entries {
+			if root := rootOf(entry.Path, ro.roots); root != "" {
+				roots[root] = true
+			}
+		}
+		if len(roots) < 2 {
+			return nil
+		}
+	}
+	group := report.NewGroup(dset.NewGroup(entries), keep.Decide(entries, ro.rules), ro.verify)
+	if len(ro.roots) > 1 {
+		for i := range group.Files {
+			group.Files[i].Root = rootOf(group.Files[i].Path, ro.roots)
+		}
+	}
+	summary.AddGroup(group)
+	return reporter.Group(group)
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/action"
+	"lostbearlabs.com/ddet/filedb"
+	"path/filepath"
+	"time"
+)
+
+// The "dedupe" command:  scans a folder, then deletes or quarantines
+// all but one file from each group of duplicates, recording what it did
+// in a journal.
+func runDedupe(args []string) int {
+	flags := newFlagSet("ddet dedupe", "ddet dedupe <folder> -action=delete|quarantine [-v] [options]")
+	sf := addScanFlags(flags)
+	kf := addKeepFlags(flags)
+	actionName := flags.String("action", "", "what to do with duplicates: delete, or quarantine to move them into the trash folder")
+	trashDir := flags.String("trash", "", "folder to quarantine files and write journals in (default ~/.ddet-trash)")
+	journalPath := flags.String("journal", "", "file to record the files removed in, for undo (default: a new file in the trash folder)")
+	dryRun := flags.Bool("dry-run", false, "report what would be removed without changing anything")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	opts, err := sf.options(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	rules, err := kf.rules(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if *actionName != action.ActionDelete && *actionName != action.ActionQuarantine {
+		return usageError(flags, fmt.Errorf("-action must be %s or %s", action.ActionDelete, action.ActionQuarantine))
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one folder"))
+	}
+
+	if *trashDir == "" {
+		home, err := homeDir()
+		if err != nil {
+			return commandError(err)
+		}
+		*trashDir = filepath.Join(home, ".ddet-trash")
+	}
+	run := time.Now().Format("20060102-150405.000")
+	if *journalPath == "" {
+		*journalPath = filepath.Join(*trashDir, "journal-"+run+".jsonl")
+	}
+
+	path := paths[0]
+	db, err := sf.openFoldersAndDB(path)
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	var journal *action.Journal
+	if !*dryRun {
+		err = action.PrepareTrash(*trashDir)
+		if err == nil {
+			journal, err = action.CreateJournal(*journalPath)
+		}
+		if err != nil {
+			return commandError(err)
+		}
+		defer journal.Close()
+	}
+
+	_, err = scanFiles([]string{path}, db, opts)
+	if err != nil {
+		return commandError(err)
+	}
+
+	verb := map[string]string{action.ActionDelete: "Deleted", action.ActionQuarantine: "Quarantined"}[*actionName]
+	if *dryRun {
+		verb = "Would " + *actionName
+	}
+	format := verb + " %s, keeping %s\n"
+	quarantineDir := filepath.Join(*trashDir, run)
+
+	totals, err := actOnDuplicates(db, path, opts.Filter, rules, *kf.explain, format, func(identical []filedb.FileEntry, keeper int) *action.Result {
+		if *actionName == action.ActionDelete {
+			return action.Delete(db, identical, keeper, journal, *dryRun)
+		}
+		return action.Quarantine(db, identical, keeper, quarantineDir, journal, *dryRun)
+	})
+	logger.Infof("%d files removed, %d bytes reclaimed, %d files protected, %d files left alone", totals.done, totals.reclaimed, totals.protected, totals.leftAlone)
+	if journal != nil {
+		logger.Infof("to undo, run:  ddet undo %s", journal.Path())
+	}
+	if err != nil {
+		return commandError(err)
+	}
+	return totals.exitCode()
+}
+
+// The "undo" command:  restores the files removed by a dedupe, as
+// recorded in its journal.
+func runUndo(args []string) int {
+	flags := newFlagSet("ddet undo", "ddet undo <journal> [-v] [-dry-run]")
+	cf := addCommonFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "report what would be restored without changing anything")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	setLogging(*cf.verbose)
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one journal"))
+	}
+
+	entries, err := action.ReadJournal(paths[0])
+	if err != nil {
+		return commandError(err)
+	}
+
+	db, err := cf.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	result := action.Undo(db, entries, *dryRun)
+	verb := "Restored"
+	if *dryRun {
+		verb = "Would restore"
+	}
+	for _, entry := range result.Restored {
+		fmt.Printf("%s %s\n", verb, entry.Path)
+	}
+	logger.Infof("%d files restored, %d skipped, %d failed", len(result.Restored), len(result.Skipped), len(result.Failed))
+	if len(result.Failed) > 0 {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/dirs"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/report"
+	"os"
+)
+
+// The "dirs" command:  reports the directories beneath a path that are
+// copies of each other, from the database, followed by the duplicate
+// files that aren't copies just because their directories are.  With
+// -similar, it also reports the directories that are nearly the same, or
+// where one holds everything in the other.
+func runDirs(args []string) int {
+	flags := newFlagSet("ddet dirs", "ddet dirs <path> [-similar FRACTION] [-files=false] [-v] [options]")
+	ff := addFilterFlags(flags)
+	kf := addKeepFlags(flags)
+	files := flags.Bool("files", true, "also report the duplicate files outside the duplicate directories")
+	similar := flags.Float64("similar", 0, "also report pairs of directories with at least this fraction of their file contents in common, e.g. 0.9, or where one contains the other")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	f, err := ff.filter(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	rules, err := kf.rules(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if *similar < 0 || *similar > 1 {
+		return usageError(flags, errors.New("-similar should be between 0 and 1"))
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one path"))
+	}
+	path := paths[0]
+
+	db, err := ff.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	tree, err := dirs.Build(db, path, f)
+	if err != nil {
+		return commandError(err)
+	}
+	groups := tree.Groups()
+	var reclaimable int64
+	for _, g := range groups {
+		fmt.Printf("Directories with identical contents, %d files and %d bytes each:\n", g.Dirs[0].NumFiles, g.Dirs[0].Size)
+		for _, d := range g.Dirs {
+			fmt.Printf("   %s\n", d.Path)
+		}
+		reclaimable += g.Reclaimable()
+	}
+	logger.Infof("found %d groups of duplicate directories, %d bytes reclaimable", len(groups), reclaimable)
+
+	code := exitOK
+	if len(groups) > 0 {
+		code = exitDuplicates
+	}
+
+	if *similar > 0 {
+		ks, keys := findDuplicates(db, []string{path}, f)
+		pairs, err := tree.Similar(db, ks, keys, *similar)
+		if err != nil {
+			return commandError(err)
+		}
+		for _, p := range pairs {
+			fmt.Printf("Directories %.0f%% similar, %d files in both, %d bytes freed by removing the first:\n", 100*p.Similarity, p.Shared, p.Reclaimable())
+			fmt.Printf("   %s (%d files only here)\n", p.Small.Path, p.SmallOnly)
+			fmt.Printf("   %s (%d files only here)\n", p.Large.Path, p.LargeOnly)
+		}
+		logger.Infof("found %d pairs of similar directories", len(pairs))
+		if len(pairs) > 0 {
+			code = exitDuplicates
+		}
+	}
+	if !*files {
+		return code
+	}
+
+	ro := reportOptions{
+		rules:  rules,
+		format: "text",
+		opts:   report.Options{Explain: *kf.explain},
+		out:    os.Stdout,
+		omit: func(entries []filedb.FileEntry) bool {
+			paths := make([]string, len(entries))
+			for i, entry := range entries {
+				paths[i] = entry.Path
+			}
+			return tree.Implied(paths)
+		},
+	}
+	fileCode := reportExitCode(analyzeDuplicates(db, []string{path}, f, ro, nil))
+	if fileCode != exitOK {
+		code = fileCode
+	}
+	return code
+}
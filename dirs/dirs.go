@@ -0,0 +1,204 @@
+package dirs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/juju/loggo"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"lostbearlabs.com/ddet/util"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+var logger = loggo.GetLogger("dirs")
+
+// A directory, and totals over all the files beneath it.
+type Dir struct {
+	Path string
+	// a hash of the names, lengths, and hashes of everything beneath the
+	// directory, or "" if it has a file that hasn't been fully hashed
+	// and so can't be a copy of any other directory
+	Hash     string
+	NumFiles int
+	Size     int64
+	// the number of those files that are empty
+	empty int
+}
+
+// Directories with identical contents.
+type Group struct {
+	Dirs []*Dir
+}
+
+// Returns the bytes freed by reducing the group to a single copy.
+func (g Group) Reclaimable() int64 {
+	return int64(len(g.Dirs)-1) * g.Dirs[0].Size
+}
+
+// The directories beneath a root, as recorded in the FileDB, with a
+// Merkle-style hash of each one's contents:  the hash of a directory is
+// computed from the name, length, and hash of each file in it and the
+// name and hash of each directory in it, so directories have the same
+// hash when everything beneath them has the same names and contents.
+type Tree struct {
+	root  string
+	dirs  map[string]*Dir
+	count map[string]int
+}
+
+// A directory whose hash is still being computed.
+type openDir struct {
+	dir *Dir
+	// one line for each child
+	children []string
+	unique   bool
+}
+
+// Computes the hashes of the directories beneath the root from the
+// entries in the FileDB, leaving out the files the filter doesn't
+// match.  Directories that have no files beneath them aren't in the
+// FileDB, so they are ignored.
+func Build(db *filedb.FileDB, root string, f *filter.Filter) (*Tree, error) {
+	t := &Tree{root: filepath.Clean(root), dirs: make(map[string]*Dir), count: make(map[string]int)}
+
+	// Entries are read in path order, so everything beneath a directory
+	// is read together, and a directory is complete once an entry
+	// outside it is read.  The stack holds the directory of the last
+	// entry and its ancestors, up to the root.
+	var stack []*openDir
+	closeTop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		t.finish(top)
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, fmt.Sprintf("d %s %s", strconv.Quote(filepath.Base(top.dir.Path)), top.dir.Hash))
+			parent.dir.NumFiles += top.dir.NumFiles
+			parent.dir.Size += top.dir.Size
+			parent.dir.empty += top.dir.empty
+			parent.unique = parent.unique || top.unique
+		}
+	}
+
+	err := db.ProcessAllFileEntries(func(e filedb.FileEntry) {
+		if !f.MatchFile(e.Path) || !f.MatchSize(e.Length) {
+			return
+		}
+		dir := filepath.Dir(e.Path)
+		if !util.IsWithin(dir, t.root) {
+			return
+		}
+
+		for len(stack) > 0 && !util.IsWithin(dir, stack[len(stack)-1].dir.Path) {
+			closeTop()
+		}
+		var opened []*openDir
+		for d := dir; len(stack) == 0 || d != stack[len(stack)-1].dir.Path; d = filepath.Dir(d) {
+			opened = append(opened, &openDir{dir: &Dir{Path: d}})
+			if d == t.root {
+				break
+			}
+		}
+		for i := len(opened) - 1; i >= 0; i-- {
+			stack = append(stack, opened[i])
+		}
+
+		top := stack[len(stack)-1]
+		top.children = append(top.children, fmt.Sprintf("f %s %s:%s %d", strconv.Quote(filepath.Base(e.Path)), e.HashAlg, e.Hash, e.Length))
+		top.dir.NumFiles++
+		top.dir.Size += e.Length
+		if e.Length == 0 {
+			top.dir.empty++
+		}
+		top.unique = top.unique || e.Hash == ""
+	}, t.root)
+	if err != nil {
+		return nil, err
+	}
+	for len(stack) > 0 {
+		closeTop()
+	}
+
+	logger.Infof("hashed %d directories", len(t.dirs))
+	return t, nil
+}
+
+func (t *Tree) finish(d *openDir) {
+	if !d.unique {
+		sort.Strings(d.children)
+		h := sha256.New()
+		for _, child := range d.children {
+			h.Write([]byte(child))
+			h.Write([]byte{'\n'})
+		}
+		d.dir.Hash = hex.EncodeToString(h.Sum(nil))
+		t.count[d.dir.Hash]++
+	}
+	t.dirs[d.dir.Path] = d.dir
+}
+
+// Returns the directory at the path, or nil if it isn't in the tree.
+func (t *Tree) Dir(path string) *Dir {
+	return t.dirs[path]
+}
+
+// Returns true if the directory has a copy elsewhere in the tree.
+func (t *Tree) IsDuplicated(d *Dir) bool {
+	return d.Hash != "" && t.count[d.Hash] > 1
+}
+
+// Returns the groups of identical directories, largest first.  Groups
+// that are implied by a larger group are left out:  if two directories
+// are identical then so are their subdirectories.
+func (t *Tree) Groups() []Group {
+	byHash := make(map[string][]*Dir)
+	for _, d := range t.dirs {
+		if t.IsDuplicated(d) {
+			byHash[d.Hash] = append(byHash[d.Hash], d)
+		}
+	}
+
+	var groups []Group
+	for _, dirs := range byHash {
+		paths := make([]string, len(dirs))
+		for i, d := range dirs {
+			paths[i] = d.Path
+		}
+		if t.Implied(paths) {
+			continue
+		}
+		sort.Slice(dirs, func(i, j int) bool { return dirs[i].Path < dirs[j].Path })
+		groups = append(groups, Group{dirs})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.Reclaimable() != b.Reclaimable() {
+			return a.Reclaimable() > b.Reclaimable()
+		}
+		return a.Dirs[0].Path < b.Dirs[0].Path
+	})
+	return groups
+}
+
+// Returns true if the paths, of files or directories with identical
+// contents, are only copies of each other because their parents are:
+// they all have the same name, and their parents are identical
+// directories.
+func (t *Tree) Implied(paths []string) bool {
+	name := filepath.Base(paths[0])
+	hash := ""
+	for _, path := range paths {
+		if filepath.Base(path) != name {
+			return false
+		}
+		parent := t.dirs[filepath.Dir(path)]
+		if parent == nil || !t.IsDuplicated(parent) || (hash != "" && parent.Hash != hash) {
+			return false
+		}
+		hash = parent.Hash
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+package dirs
+
+import (
+	"fmt"
+	"lostbearlabs.com/ddet/dset"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"testing"
+)
+
+func buildTestTree(t *testing.T, f *filter.Filter) *Tree {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	x := func(path string) *filedb.FileEntry {
+		return filedb.NewTestFileEntry().SetPath(path).SetLength(10).SetHash("aaaa")
+	}
+	y := func(path string) *filedb.FileEntry {
+		return filedb.NewTestFileEntry().SetPath(path).SetLength(20).SetHash("bbbb")
+	}
+	db.StoreFileEntries([]*filedb.FileEntry{
+		x("/r/a/x.txt"), y("/r/a/sub/y.txt"),
+		x("/r/b/x.txt"), y("/r/b/sub/y.txt"),
+		y("/r/c/sub/y.txt"), x("/r/c/x.txt.bak"),
+		x("/r/d/x.txt"), y("/r/d/sub/y.txt"), filedb.NewTestFileEntry().SetPath("/r/d/z.txt").SetHash(""),
+		x("/r2/a/x.txt"), y("/r2/a/sub/y.txt"),
+	})
+
+	tree, err := Build(db, "/r", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestBuild(t *testing.T) {
+	tree := buildTestTree(t, filter.New())
+
+	a := tree.Dir("/r/a")
+	if a == nil || a.NumFiles != 2 || a.Size != 30 || a.Hash == "" {
+		t.Fatal("bad dir, got ", a)
+	}
+	if b := tree.Dir("/r/b"); b.Hash != a.Hash || !tree.IsDuplicated(b) {
+		t.Error("copies should have the same hash, got ", a, b)
+	}
+	if c := tree.Dir("/r/c"); c.Hash == a.Hash || tree.IsDuplicated(c) {
+		t.Error("a file with a different name should change the hash, got ", c)
+	}
+	if d := tree.Dir("/r/d"); d.Hash != "" || d.NumFiles != 3 {
+		t.Error("a dir with an unhashed file should be unique, got ", d)
+	}
+	if r := tree.Dir("/r"); r == nil || r.NumFiles != 9 {
+		t.Error("bad root, got ", r)
+	}
+	if tree.Dir("/r2/a") != nil || tree.Dir("/") != nil {
+		t.Error("dirs outside the root should be left out")
+	}
+}
+
+func TestGroups(t *testing.T) {
+	tree := buildTestTree(t, filter.New())
+
+	groups := tree.Groups()
+	if len(groups) != 2 {
+		t.Fatal("wrong number of groups, got ", groups)
+	}
+	// /r/d/sub is in the first group, even though /r/d is unique
+	if len(groups[0].Dirs) != 4 || groups[0].Dirs[3].Path != "/r/d/sub" || groups[0].Reclaimable() != 60 {
+		t.Error("bad first group, got ", groups[0].Dirs)
+	}
+	if len(groups[1].Dirs) != 2 || groups[1].Dirs[0].Path != "/r/a" || groups[1].Dirs[1].Path != "/r/b" {
+		t.Error("bad second group, got ", groups[1].Dirs)
+	}
+}
+
+func TestImplied(t *testing.T) {
+	tree := buildTestTree(t, filter.New())
+
+	if !tree.Implied([]string{"/r/a/x.txt", "/r/b/x.txt"}) {
+		t.Error("files in identical dirs should be implied")
+	}
+	if !tree.Implied([]string{"/r/a/sub/y.txt", "/r/b/sub/y.txt", "/r/c/sub/y.txt", "/r/d/sub/y.txt"}) {
+		t.Error("files in identical subdirs should be implied")
+	}
+	if tree.Implied([]string{"/r/a/x.txt", "/r/b/x.txt", "/r/d/x.txt"}) {
+		t.Error("a file in a unique dir should not be implied")
+	}
+	if tree.Implied([]string{"/r/a/x.txt", "/r/b/sub/y.txt"}) {
+		t.Error("files with different names should not be implied")
+	}
+}
+
+func TestBuildWithFilter(t *testing.T) {
+	f := filter.New()
+	f.Exclude("*.bak")
+	f.Exclude("z.txt")
+	tree := buildTestTree(t, f)
+
+	// without the files filtered out, d is the same as a and b
+	groups := tree.Groups()
+	if len(groups) != 2 || len(groups[0].Dirs) != 3 || groups[0].Dirs[2].Path != "/r/d" {
+		t.Error("bad groups, got ", groups)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	file := func(path string, length int64) *filedb.FileEntry {
+		return filedb.NewTestFileEntry().SetPath(path).SetLength(length).SetHash(fmt.Sprintf("%04x", length))
+	}
+	db.StoreFileEntries([]*filedb.FileEntry{
+		file("/s/old/a", 10), file("/s/old/b", 20), file("/s/old/sub/c", 30), file("/s/old/.keep", 0),
+		file("/s/new/a", 10), file("/s/new/b", 20), file("/s/new/d", 40), file("/s/new/sub/c", 30), file("/s/new/sub/e", 50),
+		file("/s/near/a", 10), file("/s/near/b", 20), file("/s/near/f", 60), file("/s/near/sub/c", 30),
+	})
+
+	tree, err := Build(db, "/s", filter.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := dset.New()
+	ks.SetFilter(filter.New())
+	ks.AddAll(db, "/s")
+	pairs, err := tree.Similar(db, ks, ks.GetDuplicateKeys(), 0.7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// old is in both new and near, and more like near;  near/sub is in
+	// new/sub;  old/sub is implied by old and new, and is the same as
+	// near/sub
+	if len(pairs) != 3 {
+		t.Fatal("wrong number of pairs, got ", pairs)
+	}
+	p := pairs[0]
+	if p.Small.Path != "/s/old" || p.Large.Path != "/s/near" || p.Shared != 3 || p.SmallOnly != 0 || p.LargeOnly != 1 || p.Similarity != 0.75 || p.Reclaimable() != 60 {
+		t.Error("bad first pair, got ", p, p.Small, p.Large)
+	}
+	p = pairs[1]
+	if p.Small.Path != "/s/old" || p.Large.Path != "/s/new" || !p.Subset() || p.LargeOnly != 2 || p.Similarity != 0.6 {
+		t.Error("bad second pair, got ", p, p.Small, p.Large)
+	}
+	p = pairs[2]
+	if p.Small.Path != "/s/near/sub" || p.Large.Path != "/s/new/sub" || !p.Subset() || p.Reclaimable() != 30 {
+		t.Error("bad third pair, got ", p, p.Small, p.Large)
+	}
+}
+
+func TestSimilarSkipsContentsEverywhere(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	// a license file in every project, and one project copied
+	var entries []*filedb.FileEntry
+	for i := 0; i <= maxHolders; i++ {
+		entries = append(entries, filedb.NewTestFileEntry().SetPath(fmt.Sprintf("/t/p%03d/LICENSE", i)).SetLength(10).SetHash("aaaa"))
+	}
+	entries = append(entries,
+		filedb.NewTestFileEntry().SetPath("/t/p000/main.go").SetLength(20).SetHash("bbbb"),
+		filedb.NewTestFileEntry().SetPath("/t/p001/main.go").SetLength(20).SetHash("bbbb"),
+		filedb.NewTestFileEntry().SetPath("/t/p001/extra.go").SetLength(30).SetHash("cccc"))
+	db.StoreFileEntries(entries)
+
+	tree, err := Build(db, "/t", filter.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := dset.New()
+	ks.SetFilter(filter.New())
+	ks.AddAll(db, "/t")
+	pairs, err := tree.Similar(db, ks, ks.GetDuplicateKeys(), 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the license is left out of what the projects share
+	if len(pairs) != 1 || pairs[0].Shared != 1 || pairs[0].Similarity != 0.25 {
+		t.Fatal("wrong pairs, got ", pairs)
+	}
+}
@@ -0,0 +1,223 @@
+package dirs
+
+import (
+	"lostbearlabs.com/ddet/dset"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/util"
+	"path/filepath"
+	"sort"
+)
+
+// Two directories that have some of the same file contents.  Contents
+// are counted once however many copies a directory has of them, and
+// empty files aren't counted at all.
+type Pair struct {
+	// the smaller of the two directories, by size, and the larger
+	Small *Dir
+	Large *Dir
+	// the number of contents in both directories, and in only one
+	Shared    int
+	SmallOnly int
+	LargeOnly int
+	// the Jaccard similarity of the directories:  the contents in both,
+	// as a fraction of the contents in either
+	Similarity float64
+}
+
+// Returns true if everything in one directory is also in the other.
+func (p Pair) Subset() bool {
+	return p.SmallOnly == 0 || p.LargeOnly == 0
+}
+
+// Returns the bytes freed by removing the smaller directory.
+func (p Pair) Reclaimable() int64 {
+	return p.Small.Size
+}
+
+// The most directories that copies of one content may be beneath for it
+// to be counted towards the pairs.  Every pair of them is counted, so a
+// content with copies all over the tree, like a license file in every
+// project, would take time quadratic in its copies and their depth;  it
+// is skipped instead, and so it isn't counted as shared by any pair.
+const maxHolders = 256
+
+type pairKey struct {
+	a, b string
+}
+
+func newPairKey(a string, b string) pairKey {
+	if a > b {
+		a, b = b, a
+	}
+	return pairKey{a, b}
+}
+
+// Returns the pairs of directories that are at least as similar as the
+// threshold, or where one has nothing the other doesn't, largest first.
+// The contents the directories share are found by reading the files
+// with each of the duplicate keys, which should come from a
+// KnownFileSet built with the same filter as the tree.
+//
+// Pairs that the exact groups already cover are left out, and only the
+// first directory of an exact group is paired with others.  So are pairs
+// implied by their parents:  if two directories are similar, so are
+// their subdirectories of the same name.  A directory is only reported
+// as a subset of the smallest directories that contain it, since
+// everything above those contains it too.  Contents whose copies are
+// beneath more than maxHolders directories are skipped.
+func (t *Tree) Similar(db *filedb.FileDB, ks *dset.KnownFileSet, keys []dset.KnownFileKey, threshold float64) ([]Pair, error) {
+	// the number of distinct contents beneath each directory, which is
+	// the number of files less the empty ones and the extra copies
+	distinct := make(map[string]int)
+	for path, d := range t.dirs {
+		distinct[path] = d.NumFiles - d.empty
+	}
+	shared := make(map[pairKey]int)
+	skipped := 0
+
+	for _, key := range keys {
+		entries, err := ks.GetFileEntries(db, key)
+		if err != nil {
+			return nil, err
+		}
+		copies := make(map[string]int)
+		for _, e := range entries {
+			if e.Length == 0 {
+				break
+			}
+			for d := filepath.Dir(e.Path); t.dirs[d] != nil; d = filepath.Dir(d) {
+				copies[d]++
+				if d == t.root {
+					break
+				}
+			}
+		}
+		for d, n := range copies {
+			distinct[d] -= n - 1
+		}
+		if len(copies) < 2 {
+			continue
+		}
+		if len(copies) > maxHolders {
+			logger.Debugf("skipping %d copies of %d bytes with hash %s, beneath %d directories",
+				len(entries), entries[0].Length, entries[0].Hash, len(copies))
+			skipped++
+			continue
+		}
+
+		holders := make([]string, 0, len(copies))
+		for d := range copies {
+			holders = append(holders, d)
+		}
+		for i, a := range holders {
+			for _, b := range holders[i+1:] {
+				if !util.IsWithin(a, b) && !util.IsWithin(b, a) {
+					shared[newPairKey(a, b)]++
+				}
+			}
+		}
+	}
+	if skipped > 0 {
+		logger.Infof("left %d contents out of the similar directories, since their copies are beneath more than %d directories", skipped, maxHolders)
+	}
+	logger.Tracef("%d pairs of directories share contents", len(shared))
+
+	candidates := make(map[pairKey]*Pair)
+	containers := make(map[string][]string)
+	for k, n := range shared {
+		p := t.newPair(k, n, distinct)
+		if p.Similarity < threshold && !p.Subset() {
+			continue
+		}
+		candidates[k] = p
+		if distinct[k.a] == n {
+			containers[k.a] = append(containers[k.a], k.b)
+		}
+		if distinct[k.b] == n {
+			containers[k.b] = append(containers[k.b], k.a)
+		}
+	}
+
+	// the first directory of each exact group
+	first := make(map[string]string)
+	for path, d := range t.dirs {
+		if t.IsDuplicated(d) && (first[d.Hash] == "" || path < first[d.Hash]) {
+			first[d.Hash] = path
+		}
+	}
+	represents := func(d *Dir) bool {
+		return !t.IsDuplicated(d) || first[d.Hash] == d.Path
+	}
+
+	var pairs []Pair
+	for k, p := range candidates {
+		if p.Small.Hash != "" && p.Small.Hash == p.Large.Hash {
+			continue
+		}
+		if !represents(p.Small) || !represents(p.Large) {
+			continue
+		}
+		if t.impliedPair(k, candidates) {
+			continue
+		}
+		if p.Subset() && !minimalContainer(k.a, k.b, containers) && !minimalContainer(k.b, k.a, containers) {
+			continue
+		}
+		pairs = append(pairs, *p)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i], pairs[j]
+		if a.Reclaimable() != b.Reclaimable() {
+			return a.Reclaimable() > b.Reclaimable()
+		}
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		return a.Small.Path < b.Small.Path
+	})
+	return pairs, nil
+}
+
+func (t *Tree) newPair(k pairKey, shared int, distinct map[string]int) *Pair {
+	small, large := t.dirs[k.a], t.dirs[k.b]
+	if large.Size < small.Size {
+		small, large = large, small
+	}
+	p := &Pair{
+		Small:     small,
+		Large:     large,
+		Shared:    shared,
+		SmallOnly: distinct[small.Path] - shared,
+		LargeOnly: distinct[large.Path] - shared,
+	}
+	p.Similarity = float64(shared) / float64(shared+p.SmallOnly+p.LargeOnly)
+	return p
+}
+
+// Returns true if the directories have the same name and their parents
+// are identical or are themselves a similar pair.
+func (t *Tree) impliedPair(k pairKey, candidates map[pairKey]*Pair) bool {
+	if filepath.Base(k.a) != filepath.Base(k.b) {
+		return false
+	}
+	pa, pb := filepath.Dir(k.a), filepath.Dir(k.b)
+	if candidates[newPairKey(pa, pb)] != nil {
+		return true
+	}
+	parentA, parentB := t.dirs[pa], t.dirs[pb]
+	return parentA != nil && parentB != nil && t.IsDuplicated(parentA) && parentA.Hash == parentB.Hash
+}
+
+// Returns true if the container holds everything in the directory and
+// none of the other directories that do is beneath it.
+func minimalContainer(dir string, container string, containers map[string][]string) bool {
+	found := false
+	for _, other := range containers[dir] {
+		if other == container {
+			found = true
+		} else if util.IsWithin(other, container) {
+			return false
+		}
+	}
+	return found
+}
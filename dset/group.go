@@ -0,0 +1,63 @@
+package dset
+
+import (
+	"lostbearlabs.com/ddet/filedb"
+)
+
+// A group of files with identical contents.  Some members of the group
+// may be hardlinks to the same underlying file;  these take up no more
+// space than a single copy, so they are counted separately.
+type Group struct {
+	Entries []filedb.FileEntry
+	// for each entry, the index of an earlier entry that is a
+	// hardlink to the same file, or -1 if there is none
+	linkedTo  []int
+	numCopies int
+}
+
+func NewGroup(entries []filedb.FileEntry) *Group {
+	g := &Group{Entries: entries, linkedTo: make([]int, len(entries))}
+	first := make(map[[2]int64]int)
+	for i, entry := range entries {
+		g.linkedTo[i] = -1
+		if entry.Inode != 0 {
+			id := [2]int64{entry.Device, entry.Inode}
+			if j, ok := first[id]; ok {
+				g.linkedTo[i] = j
+				continue
+			}
+			first[id] = i
+		}
+		g.numCopies++
+	}
+	return g
+}
+
+// Returns the length of each file in the group.
+func (g *Group) Length() int64 {
+	if len(g.Entries) == 0 {
+		return 0
+	}
+	return g.Entries[0].Length
+}
+
+// If the i'th entry is a hardlink to the same file as an earlier entry,
+// returns the earlier entry's index and true.
+func (g *Group) LinkedTo(i int) (int, bool) {
+	return g.linkedTo[i], g.linkedTo[i] >= 0
+}
+
+// Returns the number of separate copies of the file, i.e. the number of
+// entries less any that are hardlinks to an earlier entry.
+func (g *Group) NumCopies() int {
+	return g.numCopies
+}
+
+// Returns the number of bytes that would be freed by reducing the group
+// to a single copy.
+func (g *Group) Reclaimable() int64 {
+	if g.numCopies < 2 {
+		return 0
+	}
+	return int64(g.numCopies-1) * g.Length()
+}
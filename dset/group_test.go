@@ -0,0 +1,60 @@
+package dset
+
+import (
+	"lostbearlabs.com/ddet/filedb"
+	"testing"
+)
+
+func TestGroupWithoutLinks(t *testing.T) {
+	g := NewGroup([]filedb.FileEntry{
+		*filedb.NewTestFileEntry().SetPath("/foo1.txt").SetDevice(1).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/foo2.txt").SetDevice(1).SetInode(11),
+		*filedb.NewTestFileEntry().SetPath("/foo3.txt"),
+		*filedb.NewTestFileEntry().SetPath("/foo4.txt"),
+	})
+
+	if g.NumCopies() != 4 {
+		t.Error("wrong number of copies, got ", g.NumCopies())
+	}
+	if g.Reclaimable() != 3*128 {
+		t.Error("wrong reclaimable bytes, got ", g.Reclaimable())
+	}
+	for i := range g.Entries {
+		if _, linked := g.LinkedTo(i); linked {
+			t.Error("entry should not be linked, index ", i)
+		}
+	}
+}
+
+func TestGroupWithLinks(t *testing.T) {
+	g := NewGroup([]filedb.FileEntry{
+		*filedb.NewTestFileEntry().SetPath("/foo1.txt").SetDevice(1).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/foo2.txt").SetDevice(2).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/foo3.txt").SetDevice(1).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/foo4.txt").SetDevice(2).SetInode(10),
+	})
+
+	if g.NumCopies() != 2 {
+		t.Error("wrong number of copies, got ", g.NumCopies())
+	}
+	if g.Reclaimable() != 128 {
+		t.Error("wrong reclaimable bytes, got ", g.Reclaimable())
+	}
+	if to, linked := g.LinkedTo(2); !linked || to != 0 {
+		t.Error("entry 2 should be linked to 0, got ", to)
+	}
+	if to, linked := g.LinkedTo(3); !linked || to != 1 {
+		t.Error("entry 3 should be linked to 1, got ", to)
+	}
+}
+
+func TestGroupOfOnlyLinks(t *testing.T) {
+	g := NewGroup([]filedb.FileEntry{
+		*filedb.NewTestFileEntry().SetPath("/foo1.txt").SetDevice(1).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/foo2.txt").SetDevice(1).SetInode(10),
+	})
+
+	if g.NumCopies() != 1 || g.Reclaimable() != 0 {
+		t.Error("group should have nothing to reclaim, got ", g.NumCopies(), " copies")
+	}
+}
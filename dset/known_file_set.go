@@ -4,6 +4,9 @@ import (
 	"encoding/hex"
 	"github.com/juju/loggo"
 	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"lostbearlabs.com/ddet/util"
+	"path/filepath"
 	"sort"
 )
 
@@ -12,18 +15,25 @@ var logger = loggo.GetLogger("dset")
 // The key used to compare files.  Files with the same key are
 // treated as identical.
 type KnownFileKey struct {
-	md5    string
-	length int64
+	hashAlg string
+	hash    string
+	length  int64
 }
 
 // ByLength implements sort.Interface for []KnownFileKey based on
-// the length field first, then the md5
+// the length field first, then the hash
 type ByLength []KnownFileKey
 
 func (a ByLength) Len() int      { return len(a) }
 func (a ByLength) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a ByLength) Less(i, j int) bool {
-	return (a[i].length < a[j].length) || ((a[i].length == a[j].length) && (a[i].md5 < a[j].md5))
+	if a[i].length != a[j].length {
+		return a[i].length < a[j].length
+	}
+	if a[i].hash != a[j].hash {
+		return a[i].hash < a[j].hash
+	}
+	return a[i].hashAlg < a[j].hashAlg
 }
 
 // A set of files, from which we can extract any duplicate files,
@@ -39,6 +49,9 @@ type KnownFileSet struct {
 	// strongest filter, counting occurences of each key for each
 	// key that really is duplicated
 	knownKeys map[KnownFileKey]uint64
+
+	// files to leave out, even if they are in the database
+	filter *filter.Filter
 }
 
 func New() *KnownFileSet {
@@ -46,28 +59,41 @@ func New() *KnownFileSet {
 	mp2 := make(map[KnownFileKey]bool)
 	wf, _ := newWeakFilter()
 
-	return &KnownFileSet{0, wf, mp2, knownKeys}
+	return &KnownFileSet{0, wf, mp2, knownKeys, nil}
+}
+
+// Sets the filter used to leave files out of the set.  This should be
+// called before AddAll().
+func (k *KnownFileSet) SetFilter(f *filter.Filter) {
+	k.filter = f
+}
+
+// Returns true if the entry passes our filter.
+func (k *KnownFileSet) matches(e filedb.FileEntry) bool {
+	return k.filter.MatchFile(e.Path) && k.filter.MatchSize(e.Length)
 }
 
 func (k *KnownFileSet) GetNumFiles() int64 {
 	return k.numFiles
 }
 
-// Adds all files from the database (prefixed by the specified path)
-// to the KnownFileSet.
-func (k *KnownFileSet) AddAll(db *filedb.FileDB, path string) {
+// Adds all files from the database (prefixed by any of the specified
+// paths) to the KnownFileSet.
+func (k *KnownFileSet) AddAll(db *filedb.FileDB, paths ...string) {
 
 	// Weakly identify all the keys that occur more than once
-	err := db.ProcessAllFileEntries(k.populateFilters, path)
-	if err != nil {
-		logger.Errorf("error processing file entries [%v]", err)
-		return
+	for _, path := range paths {
+		err := db.ProcessAllFileEntries(k.populateFilters, path)
+		if err != nil {
+			logger.Errorf("error processing file entries [%v]", err)
+			return
+		}
 	}
 	logger.Infof("first pass identified %d potential groups of duplicates", len(k.mp2))
 
 	// Re-process all the candidate keys to identify the ones that are really duplicated
 	for key, _ := range k.mp2 {
-		items, err := db.ReadFileEntriesByKnownFileKey(key.md5, key.length)
+		items, err := db.ReadFileEntriesByKnownFileKey(key.hashAlg, key.hash, key.length)
 		if err != nil {
 			logger.Errorf("error reading entries for key [%v]: [%v]", key, err)
 			return
@@ -80,36 +106,48 @@ func (k *KnownFileSet) AddAll(db *filedb.FileDB, path string) {
 	}
 }
 
-// Used to weakly identify candidates for MD5 duplication.
+// Used to weakly identify candidates for hash duplication.
 func (k *KnownFileSet) populateFilters(e filedb.FileEntry) {
-	md5, err := hex.DecodeString(e.Md5)
+	if !k.matches(e) {
+		return
+	}
+
+	if e.Hash == "" {
+		// The scanner only computes the full hash of a file whose
+		// length and partial hash collide with another file's, so
+		// an entry without one cannot have a duplicate.
+		k.numFiles++
+		return
+	}
+
+	hash, err := hex.DecodeString(e.Hash)
 	if err != nil {
-		logger.Errorf("got error [%v] decoding md5 for [%v]", err, e)
+		logger.Errorf("got error [%v] decoding hash for [%v]", err, e)
 		return
 	}
 
-	known, err := k.wf.contains(md5, e.Length)
+	known, err := k.wf.contains(hash, e.Length)
 	if err != nil {
-		logger.Errorf("got error [%v] from [%v] with md5 decoded as [%v]", err, e, md5)
+		logger.Errorf("got error [%v] from [%v] with hash decoded as [%v]", err, e, hash)
 		return
 	}
 
-	key := KnownFileKey{e.Md5, e.Length}
+	key := KnownFileKey{e.HashAlg, e.Hash, e.Length}
 	if known && !k.mp2[key] {
 		logger.Tracef("found interesting key: %v", key)
 		k.mp2[key] = true
 	} else {
-		k.wf.add(md5, e.Length)
+		k.wf.add(hash, e.Length)
 	}
 
 	k.numFiles++
 }
 
 // For files whose keys are already suspected of being duplicated, this
-// populates our main map of knownKeys with the count for each (MD5,Length) pair.
+// populates our main map of knownKeys with the count for each (Hash,Length) pair.
 func (k *KnownFileSet) addToKnownKeys(e filedb.FileEntry) {
-	key := KnownFileKey{e.Md5, e.Length}
-	if !k.mp2[key] {
+	key := KnownFileKey{e.HashAlg, e.Hash, e.Length}
+	if !k.mp2[key] || !k.matches(e) {
 		return
 	}
 
@@ -117,7 +155,7 @@ func (k *KnownFileSet) addToKnownKeys(e filedb.FileEntry) {
 	k.knownKeys[key] = count + 1
 }
 
-// Returns the (MD5,Length) pairs that really do correspond to duplicate files.
+// Returns the (Hash,Length) pairs that really do correspond to duplicate files.
 func (k *KnownFileSet) GetDuplicateKeys() []KnownFileKey {
 	keys := make([]KnownFileKey, 0)
 
@@ -133,19 +171,40 @@ func (k *KnownFileSet) GetDuplicateKeys() []KnownFileKey {
 	return keys
 }
 
-// Returns the file entries for a particular (MD5,Length) pair.
+// Returns the file entries for a particular (Hash,Length) pair.
 func (k *KnownFileSet) GetFileEntries(db *filedb.FileDB, key KnownFileKey) ([]filedb.FileEntry, error) {
 
 	ar := make([]filedb.FileEntry, 0)
-	items, err := db.ReadFileEntriesByKnownFileKey(key.md5, key.length)
+	items, err := db.ReadFileEntriesByKnownFileKey(key.hashAlg, key.hash, key.length)
 	if err != nil {
 		return nil, err
 	}
 	for _, item := range items {
-		if item.Length == key.length {
+		if item.Length == key.length && k.matches(item) {
 			ar = append(ar, item)
 		}
 	}
 
 	return ar, nil
 }
+
+// Returns the entries that lie beneath any of the paths.  A key is
+// duplicated if any two files in the database share it, so
+// GetFileEntries() also returns copies outside the paths given to
+// AddAll().
+func EntriesWithin(entries []filedb.FileEntry, paths ...string) []filedb.FileEntry {
+	dirs := make([]string, len(paths))
+	for i, path := range paths {
+		dirs[i] = filepath.Clean(path)
+	}
+	ar := make([]filedb.FileEntry, 0, len(entries))
+	for _, e := range entries {
+		for _, dir := range dirs {
+			if util.IsWithin(e.Path, dir) {
+				ar = append(ar, e)
+				break
+			}
+		}
+	}
+	return ar
+}
@@ -2,6 +2,7 @@ package dset
 
 import (
 	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
 	"testing"
 )
 
@@ -53,8 +54,8 @@ func NonDupNotReturned(t *testing.T) {
 	defer db.Close()
 
 	items := []*filedb.FileEntry{
-		filedb.NewTestFileEntry().SetPath("/foo1.txt").SetMd5("ABX1"),
-		filedb.NewTestFileEntry().SetPath("/foo3.txt").SetMd5("ABX2"),
+		filedb.NewTestFileEntry().SetPath("/foo1.txt").SetHash("ABX1"),
+		filedb.NewTestFileEntry().SetPath("/foo3.txt").SetHash("ABX2"),
 	}
 	db.StoreFileEntries(items)
 
@@ -69,3 +70,122 @@ func NonDupNotReturned(t *testing.T) {
 		t.Error("length should be 0, was", len(dupKeys))
 	}
 }
+
+func TestFilteredDupNotReturned(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	items := []*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/foo1.txt"),
+		filedb.NewTestFileEntry().SetPath("/foo2.txt"),
+		filedb.NewTestFileEntry().SetPath("/cache/foo3.txt"),
+		filedb.NewTestFileEntry().SetPath("/foo4.txt").SetHash("ABX2"),
+		filedb.NewTestFileEntry().SetPath("/cache/foo5.txt").SetHash("ABX2"),
+	}
+	db.StoreFileEntries(items)
+
+	f := filter.New()
+	f.Exclude("cache")
+
+	ks := New()
+	ks.SetFilter(f)
+	ks.AddAll(db, "")
+
+	dupKeys := ks.GetDuplicateKeys()
+	if len(dupKeys) != 1 {
+		t.Error("length should be 1, was", len(dupKeys))
+		return
+	}
+
+	entries, _ := ks.GetFileEntries(db, dupKeys[0])
+	if len(entries) != 2 {
+		t.Error("length should be 2, was", len(entries))
+	}
+}
+
+func TestDupOutsideSizeLimitsNotReturned(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	items := []*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/foo1.txt").SetLength(100),
+		filedb.NewTestFileEntry().SetPath("/foo2.txt").SetLength(100),
+		filedb.NewTestFileEntry().SetPath("/foo3.txt").SetLength(1000),
+		filedb.NewTestFileEntry().SetPath("/foo4.txt").SetLength(1000),
+	}
+	db.StoreFileEntries(items)
+
+	f := filter.New()
+	f.SetMinSize(500)
+
+	ks := New()
+	ks.SetFilter(f)
+	ks.AddAll(db, "")
+
+	dupKeys := ks.GetDuplicateKeys()
+	if len(dupKeys) != 1 {
+		t.Error("length should be 1, was", len(dupKeys))
+		return
+	}
+
+	entries, _ := ks.GetFileEntries(db, dupKeys[0])
+	if len(entries) != 2 || entries[0].Length != 1000 {
+		t.Error("wrong entries, got", entries)
+	}
+}
+
+func TestDupAcrossPathsReturnsIt(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	items := []*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/a/foo1.txt"),
+		filedb.NewTestFileEntry().SetPath("/b/foo1.txt"),
+		filedb.NewTestFileEntry().SetPath("/c/foo2.txt").SetHash("ab01"),
+		filedb.NewTestFileEntry().SetPath("/d/foo2.txt").SetHash("ab01"),
+	}
+	db.StoreFileEntries(items)
+
+	ks := New()
+	ks.AddAll(db, "/a/", "/b/", "/c/")
+
+	dupKeys := ks.GetDuplicateKeys()
+	if len(dupKeys) != 1 {
+		t.Fatal("length should be 1, was", len(dupKeys))
+	}
+	if ks.GetNumFiles() != 3 {
+		t.Error("should have 3 files, got ", ks.GetNumFiles())
+	}
+	entries, _ := ks.GetFileEntries(db, dupKeys[0])
+	if len(entries) != 2 || entries[0].Path != "/a/foo1.txt" || entries[1].Path != "/b/foo1.txt" {
+		t.Error("wrong entries, got ", entries)
+	}
+}
+
+func TestEntriesWithinLeavesOutCopiesElsewhere(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	// the parent was scanned, and now only one child is of interest
+	db.StoreFileEntries([]*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/t1/a/x"),
+		filedb.NewTestFileEntry().SetPath("/t1/a/x2"),
+		filedb.NewTestFileEntry().SetPath("/t1/b/y"),
+	})
+
+	ks := New()
+	ks.AddAll(db, "/t1/a")
+	dupKeys := ks.GetDuplicateKeys()
+	if len(dupKeys) != 1 {
+		t.Fatal("length should be 1, was", len(dupKeys))
+	}
+	entries, _ := ks.GetFileEntries(db, dupKeys[0])
+	within := EntriesWithin(entries, "/t1/a/")
+	if len(within) != 2 || within[0].Path != "/t1/a/x" || within[1].Path != "/t1/a/x2" {
+		t.Error("should only return the entries beneath the path, got ", within)
+	}
+	within = EntriesWithin(entries, "/t1/b", "/t1/a")
+	if len(within) != 3 {
+		t.Error("should return the entries beneath any of the paths, got ", within)
+	}
+}
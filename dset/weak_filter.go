@@ -8,9 +8,11 @@ import (
 
 // This is the weak filter used internally to the KnownFileSet in order
 // to improve the space efficiency of duplicate detection.  Our KnownFileKey
-// contains both the file MD5 and the file length, but our Bloom filter
-// implementation can only handle MD5 hashes, so this class just re-hashes the
-// full key and then keeps the result in a bloom filter.
+// contains both the file hash and the file length, but our Bloom filter
+// implementation only handles a single digest, so this class just re-hashes
+// the full key and then keeps the result in a bloom filter.  The re-hash only
+// spreads keys across the filter;  it is never used to decide that two files
+// are duplicates.
 type weakFilter struct {
 	bloom bloom.BloomFilter
 }
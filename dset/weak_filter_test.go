@@ -39,3 +39,23 @@ func TestHappyPath(t *testing.T) {
 		t.Error("should contain entry ")
 	}
 }
+
+func TestShortDigest(t *testing.T) {
+	filter, _ := newWeakFilter()
+
+	hash := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	len := int64(17)
+
+	err := filter.add(hash, len)
+	if err != nil {
+		t.Error(err)
+	}
+
+	rc, err := filter.contains(hash, len)
+	if err != nil {
+		t.Error(err)
+	}
+	if !rc {
+		t.Error("should contain entry ")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"lostbearlabs.com/ddet/report"
+	"os"
+)
+
+// The "export" command:  writes the database entries for every file
+// beneath a path, without scanning it first.
+func runExport(args []string) int {
+	flags := newFlagSet("ddet export", "ddet export <path> -csv [-o FILE] [-v]")
+	cf := addCommonFlags(flags)
+	asCSV := flags.Bool("csv", false, "write the entries as CSV")
+	outPath := flags.String("o", "", "file to write the entries to (default stdout)")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	setLogging(*cf.verbose)
+	if !*asCSV {
+		return usageError(flags, errors.New("only -csv is supported"))
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one path"))
+	}
+
+	db, err := cf.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return commandError(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	count, err := report.ExportCSV(db, paths[0], out)
+	if err != nil {
+		return commandError(err)
+	}
+	logger.Infof("exported %d files", count)
+	return exitOK
+}
+
+// The "import" command:  reads database entries written by export, e.g.
+// on another machine, replacing any entries for the same paths.
+func runImport(args []string) int {
+	flags := newFlagSet("ddet import", "ddet import [FILE] [-v]")
+	cf := addCommonFlags(flags)
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	setLogging(*cf.verbose)
+	if len(paths) > 1 {
+		return usageError(flags, errors.New("expected at most one file"))
+	}
+
+	var in io.Reader = os.Stdin
+	if len(paths) == 1 && paths[0] != "-" {
+		f, err := os.Open(paths[0])
+		if err != nil {
+			return commandError(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, err := cf.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	count, err := report.ImportCSV(db, in)
+	if err != nil {
+		return commandError(err)
+	}
+	logger.Infof("imported %d files", count)
+	return exitOK
+}
@@ -1,15 +1,28 @@
 package filedb
 
 // This is the information we store for each file.
-// The KnownFileSet relies on the Md5 and Length to identify
-// duplicates;  the Scanner relies on the LastMod, Length, and
-// ScanTime to identify which files need to be re-hashed.
+// The KnownFileSet relies on the HashAlg, Hash, and Length to identify
+// duplicates;  the Scanner relies on the LastMod, Length, HashAlg, and
+// ScanTime to identify which files need to be re-hashed.  The Device
+// and Inode identify the underlying file, so that hardlinks to the same
+// file can be told apart from separate copies;  they are zero if unknown.
+//
+// Files are hashed in stages, so the hashes may be empty:  the
+// PartialHash (of the start and end of the file) is only computed
+// for files whose Length is shared with some other file, and the
+// Hash (of the whole file) only for files whose Length and PartialHash
+// are both shared with some other file.  Both hashes are computed with
+// the algorithm named by HashAlg.
 type FileEntry struct {
-	Path     string
-	Length   int64
-	LastMod  int64
-	Md5      string
-	ScanTime int64
+	Path        string
+	Length      int64
+	LastMod     int64
+	Device      int64
+	Inode       int64
+	HashAlg     string
+	Hash        string
+	PartialHash string
+	ScanTime    int64
 }
 
 func NewBlankFileEntry() *FileEntry {
@@ -17,7 +30,7 @@ func NewBlankFileEntry() *FileEntry {
 }
 
 func NewTestFileEntry() *FileEntry {
-	return &FileEntry{"a.txt", 128, 0, "8d9ace9df01c0c0876a95c3f810e7e9a", 100000}
+	return &FileEntry{"a.txt", 128, 0, 0, 0, "md5", "8d9ace9df01c0c0876a95c3f810e7e9a", "8d9ace9df01c0c0876a95c3f810e7e9a", 100000}
 }
 
 func (f *FileEntry) SetPath(path string) *FileEntry {
@@ -35,8 +48,34 @@ func (f *FileEntry) SetLastMod(lastMod int64) *FileEntry {
 	return f
 }
 
-func (f *FileEntry) SetMd5(md5 string) *FileEntry {
-	f.Md5 = md5
+func (f *FileEntry) SetDevice(device int64) *FileEntry {
+	f.Device = device
+	return f
+}
+
+func (f *FileEntry) SetInode(inode int64) *FileEntry {
+	f.Inode = inode
+	return f
+}
+
+// Returns true if both entries are known to refer to the same underlying
+// file, i.e. they are hardlinks of each other.
+func (f *FileEntry) IsSameFile(other *FileEntry) bool {
+	return f.Inode != 0 && f.Inode == other.Inode && f.Device == other.Device
+}
+
+func (f *FileEntry) SetHashAlg(hashAlg string) *FileEntry {
+	f.HashAlg = hashAlg
+	return f
+}
+
+func (f *FileEntry) SetHash(hash string) *FileEntry {
+	f.Hash = hash
+	return f
+}
+
+func (f *FileEntry) SetPartialHash(partialHash string) *FileEntry {
+	f.PartialHash = partialHash
 	return f
 }
 
@@ -7,6 +7,7 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 )
 
@@ -18,16 +19,24 @@ var logger = loggo.GetLogger("scanner")
 // we could handle in memory alone.
 //
 // A FileDB should be acquired via either InitDB() or NewTempDB() and
-// *must* be closed by calling Close().
+// *must* be closed by calling Close().  It may be used from several
+// goroutines at once:  reads go straight to the *sql.DB, which is safe
+// for concurrent use, while writes are serialized so that SQLite never
+// sees two at once.
 type FileDB struct {
 	db       *sql.DB
-	mx       *sync.Mutex
+	mx       *sync.Mutex // held while writing
 	tempDir  string
 	tempFile string
 }
 
+// The path that InitDB() takes to mean a database held in memory, which
+// is thrown away when it is closed.
+const MemoryPath = ":memory:"
+
 func InitDB(filepath string) (*FileDB, error) {
-	db, err := sql.Open("sqlite3", filepath)
+	// paths are matched with LIKE, which ignores case by default
+	db, err := sql.Open("sqlite3", filepath+"?_case_sensitive_like=1")
 	if err != nil {
 		return nil, err
 	}
@@ -35,6 +44,20 @@ func InitDB(filepath string) (*FileDB, error) {
 		return nil, errors.New("DB nil")
 	}
 
+	if filepath == MemoryPath {
+		// Every connection to :memory: gets a database of its own, so
+		// there must only ever be the one.
+		db.SetMaxOpenConns(1)
+	} else {
+		// Write-ahead logging lets readers proceed while a batch is being
+		// committed, and makes large transactions much cheaper.
+		_, err = db.Exec("PRAGMA journal_mode=WAL")
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
 	err = createTableIfNotExists(db)
 	if err != nil {
 		db.Close()
@@ -83,21 +106,123 @@ func createTableIfNotExists(db *sql.DB) error {
 		Path TEXT NOT NULL PRIMARY KEY,
 		Length INT NOT NULL,
 		LastMod INT NOT NULL,
-		Md5 TEXT NOT NULL,
+		Device INT NOT NULL DEFAULT 0,
+		Inode INT NOT NULL DEFAULT 0,
+		HashAlg TEXT NOT NULL DEFAULT 'md5',
+		Hash TEXT NOT NULL,
+		PartialHash TEXT NOT NULL DEFAULT '',
 		ScanTime INT NOT NULL 
 	);
-	CREATE INDEX IF NOT EXISTS idx_md5
-		ON files (Md5);
 	`
-
 	_, err := db.Exec(sql_table)
+	if err != nil {
+		return err
+	}
+
+	err = upgradeColumns(db)
+	if err != nil {
+		return err
+	}
+
+	sql_index := `
+	DROP INDEX IF EXISTS idx_md5;
+	CREATE INDEX IF NOT EXISTS idx_hash
+		ON files (Hash, Length);
+	CREATE INDEX IF NOT EXISTS idx_length
+		ON files (Length, PartialHash);
+	`
+	_, err = db.Exec(sql_index)
 	return err
 }
 
+// Columns that have been renamed since the files table was first
+// created.  A database written by an older version is upgraded by
+// renaming any of these it still has.
+var renamedColumns = []struct {
+	oldName string
+	newName string
+}{
+	{"Md5", "Hash"},
+}
+
+// Columns that have been added to the files table since it was first
+// created, with their definitions.  A database written by an older
+// version is upgraded by adding whichever of these it lacks.  Hashes
+// stored before HashAlg was added were all MD5s.
+var addedColumns = []struct {
+	name       string
+	definition string
+}{
+	{"PartialHash", "TEXT NOT NULL DEFAULT ''"},
+	{"HashAlg", "TEXT NOT NULL DEFAULT 'md5'"},
+	{"Device", "INT NOT NULL DEFAULT 0"},
+	{"Inode", "INT NOT NULL DEFAULT 0"},
+}
+
+func upgradeColumns(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(files)")
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, col := range renamedColumns {
+		if existing[col.oldName] && !existing[col.newName] {
+			logger.Infof("renaming column %s to %s in database", col.oldName, col.newName)
+			_, err := db.Exec("ALTER TABLE files RENAME COLUMN " + col.oldName + " TO " + col.newName)
+			if err != nil {
+				return err
+			}
+			existing[col.newName] = true
+		}
+	}
+
+	for _, col := range addedColumns {
+		if !existing[col.name] {
+			logger.Infof("adding column %s to database", col.name)
+			_, err := db.Exec("ALTER TABLE files ADD COLUMN " + col.name + " " + col.definition)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The columns read for a FileEntry, in the order expected by scanFileEntry.
+const fileEntryColumns = "Path, Length, LastMod, Device, Inode, HashAlg, Hash, PartialHash, ScanTime"
+
+// Anything we can read a row from, i.e. *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFileEntry(row rowScanner) (*FileEntry, error) {
+	item := NewBlankFileEntry()
+	err := row.Scan(&item.Path, &item.Length, &item.LastMod, &item.Device, &item.Inode, &item.HashAlg, &item.Hash, &item.PartialHash, &item.ScanTime)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
 func (filedb *FileDB) StoreFileEntry(item FileEntry) error {
 	return filedb.StoreFileEntries([]*FileEntry{&item})
 }
 
+// Stores all the items in a single transaction.
 func (filedb *FileDB) StoreFileEntries(items []*FileEntry) error {
 	filedb.mx.Lock()
 	defer filedb.mx.Unlock()
@@ -107,35 +232,47 @@ func (filedb *FileDB) StoreFileEntries(items []*FileEntry) error {
 		Path,
 		Length,
 		LastMod,
-		Md5,
+		Device,
+		Inode,
+		HashAlg,
+		Hash,
+		PartialHash,
 		ScanTime
-	) values(?, ?, ?, ?, ?)
+	) values(?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	stmt, err := filedb.db.Prepare(sql_additem)
+	tx, err := filedb.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(sql_additem)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
 	for _, item := range items {
-		_, err := stmt.Exec(item.Path, item.Length, item.LastMod, item.Md5, item.ScanTime)
+		_, err := stmt.Exec(item.Path, item.Length, item.LastMod, item.Device, item.Inode, item.HashAlg, item.Hash, item.PartialHash, item.ScanTime)
 		if err != nil {
+			tx.Rollback()
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
+// Calls fn with each entry for the path or beneath it, in path order.
+// A MemoryPath database has only the one connection, which the query
+// holds until it is done, so fn must not use the FileDB.
 func (filedb *FileDB) ProcessAllFileEntries(fn func(FileEntry), path string) error {
-	filedb.mx.Lock()
-	defer filedb.mx.Unlock()
-
+	cond, args := pathCondition("Path", []string{path})
 	sql_readall := `
-	SELECT Path, Length, LastMod, Md5, ScanTime 
+	SELECT ` + fileEntryColumns + `
 	FROM files 
-	WHERE Path LIKE ?
+	WHERE ` + cond + `
 	ORDER BY Path
 	`
 
@@ -145,16 +282,14 @@ func (filedb *FileDB) ProcessAllFileEntries(fn func(FileEntry), path string) err
 	}
 	defer stmt.Close()
 
-	//fmt.Printf("path is: %s\n", path)
-	rows, err := stmt.Query(path + "%")
+	rows, err := stmt.Query(args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		item := NewBlankFileEntry()
-		err := rows.Scan(&item.Path, &item.Length, &item.LastMod, &item.Md5, &item.ScanTime)
+		item, err := scanFileEntry(rows)
 		if err != nil {
 			return err
 		}
@@ -172,53 +307,217 @@ func (filedb *FileDB) ReadAllFileEntries() ([]FileEntry, error) {
 	return result, err
 }
 
-func (filedb *FileDB) ReadFileEntriesByKnownFileKey(md5 string, length int64) ([]FileEntry, error) {
+// Runs a query that selects fileEntryColumns and returns all the
+// resulting entries.
+func (filedb *FileDB) readFileEntries(query string, args ...interface{}) ([]FileEntry, error) {
 	var result []FileEntry
-	filedb.mx.Lock()
-	defer filedb.mx.Unlock()
 
+	stmt, err := filedb.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanFileEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *item)
+	}
+	return result, nil
+}
+
+func (filedb *FileDB) ReadFileEntriesByKnownFileKey(hashAlg string, hash string, length int64) ([]FileEntry, error) {
 	sql_readall := `
-	SELECT Path, Length, LastMod, Md5, ScanTime 
+	SELECT ` + fileEntryColumns + `
 	FROM files 
-	WHERE MD5=? and Length=?
+	WHERE Hash=? and Length=? and HashAlg=?
 	ORDER BY Path
 	`
 
-	stmt, err := filedb.db.Prepare(sql_readall)
+	return filedb.readFileEntries(sql_readall, hash, length, hashAlg)
+}
+
+// Returns the entries for files of the specified length.
+func (filedb *FileDB) ReadFileEntriesByLength(length int64) ([]FileEntry, error) {
+	sql_read := `
+	SELECT ` + fileEntryColumns + `
+	FROM files
+	WHERE Length=?
+	ORDER BY Path
+	`
+
+	return filedb.readFileEntries(sql_read, length)
+}
+
+// Returns a condition matching the entries for any of the paths or
+// beneath them, for the named Path column, and its arguments.  An empty
+// path matches every entry.  Unlike a bare prefix, "/data/a" doesn't
+// match "/data/ab".
+func pathCondition(column string, paths []string) (string, []interface{}) {
+	conditions := make([]string, len(paths))
+	var args []interface{}
+	for i, path := range paths {
+		if path == "" {
+			conditions[i] = "1"
+			continue
+		}
+		dir := strings.TrimSuffix(path, "/")
+		conditions[i] = column + " = ? OR " + column + ` LIKE ? ESCAPE '\'`
+		args = append(args, dir, escapeLike(dir)+"/%")
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// Escapes the characters that LIKE treats specially, with backslashes.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Returns, in order, the lengths of entries beneath any of the specified
+// paths that are shared with some other entry.  The other entry may be
+// anywhere in the database, since an earlier scan of another folder left
+// its files unhashed if they had nothing to collide with then.  This is
+// worked out once per scan;  ReadFileEntriesNeedingPartialHash() then
+// reads the entries with a few of these lengths at a time.
+func (filedb *FileDB) ReadCollidingLengths(paths ...string) ([]int64, error) {
+	cond, args := pathCondition("Path", paths)
+	sql_read := `
+	SELECT Length
+	FROM files
+	WHERE Length IN (
+		SELECT Length
+		FROM files
+		WHERE ` + cond + `
+	)
+	GROUP BY Length
+	HAVING COUNT(*) > 1
+	ORDER BY Length
+	`
+
+	rows, err := filedb.db.Query(sql_read, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
+	defer rows.Close()
+
+	var lengths []int64
+	for rows.Next() {
+		var length int64
+		if err := rows.Scan(&length); err != nil {
+			return nil, err
+		}
+		lengths = append(lengths, length)
+	}
+	return lengths, rows.Err()
+}
 
-	rows, err := stmt.Query(md5, length)
+// Returns the entries with any of the given lengths that have no partial
+// hash yet, in length and then path order.  Entries hashed with an
+// algorithm other than hashAlg are left out.
+func (filedb *FileDB) ReadFileEntriesNeedingPartialHash(hashAlg string, lengths []int64) ([]FileEntry, error) {
+	if len(lengths) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{hashAlg}
+	for _, length := range lengths {
+		args = append(args, length)
+	}
+	sql_read := `
+	SELECT ` + fileEntryColumns + `
+	FROM files
+	WHERE PartialHash = ''
+	AND HashAlg = ?
+	AND Length IN (?` + strings.Repeat(", ?", len(lengths)-1) + `)
+	ORDER BY Length, Path
+	`
+
+	return filedb.readFileEntries(sql_read, args...)
+}
+
+// A length and partial hash shared by several entries.
+type PartialHashKey struct {
+	Length      int64
+	PartialHash string
+}
+
+// Returns, in order, the lengths and partial hashes computed with hashAlg
+// that are shared by more than one entry, where at least one of them is
+// beneath one of the specified paths.  As with ReadCollidingLengths(),
+// the others may be anywhere in the database, and this is worked out once
+// per scan for ReadFileEntriesNeedingFullHash() to read from.
+func (filedb *FileDB) ReadCollidingPartialHashes(hashAlg string, paths ...string) ([]PartialHashKey, error) {
+	cond, args := pathCondition("Path", paths)
+	sql_read := `
+	SELECT Length, PartialHash
+	FROM files
+	WHERE PartialHash != ''
+	AND HashAlg = ?
+	GROUP BY Length, PartialHash
+	HAVING COUNT(*) > 1
+	AND MAX(` + cond + `)
+	ORDER BY Length, PartialHash
+	`
+
+	rows, err := filedb.db.Query(sql_read, append([]interface{}{hashAlg}, args...)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var keys []PartialHashKey
 	for rows.Next() {
-		item := NewBlankFileEntry()
-		err := rows.Scan(&item.Path, &item.Length, &item.LastMod, &item.Md5, &item.ScanTime)
-		if err != nil {
+		var key PartialHashKey
+		if err := rows.Scan(&key.Length, &key.PartialHash); err != nil {
 			return nil, err
 		}
-		result = append(result, *item)
+		keys = append(keys, key)
 	}
-	return result, nil
+	return keys, rows.Err()
 }
 
-func (filedb *FileDB) ReadFileEntry(path string) *FileEntry {
-	filedb.mx.Lock()
-	defer filedb.mx.Unlock()
+// Returns the entries with any of the given lengths and partial hashes
+// that have no full hash yet, in length and then path order.  Entries
+// hashed with an algorithm other than hashAlg are left out.
+func (filedb *FileDB) ReadFileEntriesNeedingFullHash(hashAlg string, keys []PartialHashKey) ([]FileEntry, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	conditions := make([]string, len(keys))
+	args := []interface{}{hashAlg}
+	for i, key := range keys {
+		conditions[i] = "(Length = ? AND PartialHash = ?)"
+		args = append(args, key.Length, key.PartialHash)
+	}
+	sql_read := `
+	SELECT ` + fileEntryColumns + `
+	FROM files
+	WHERE Hash = ''
+	AND HashAlg = ?
+	AND (` + strings.Join(conditions, " OR ") + `)
+	ORDER BY Length, Path
+	`
 
+	return filedb.readFileEntries(sql_read, args...)
+}
+
+func (filedb *FileDB) ReadFileEntry(path string) *FileEntry {
 	sql_read := `
-	SELECT Path, Length, LastMod, Md5, ScanTime 
+	SELECT ` + fileEntryColumns + `
 	FROM files 
 	WHERE Path=?
 	`
 
-	item := new(FileEntry)
-	err := filedb.db.QueryRow(sql_read, path).Scan(&item.Path, &item.Length, &item.LastMod, &item.Md5, &item.ScanTime)
+	item, err := scanFileEntry(filedb.db.QueryRow(sql_read, path))
 	switch {
 	case err == sql.ErrNoRows:
 		return nil
@@ -229,15 +528,18 @@ func (filedb *FileDB) ReadFileEntry(path string) *FileEntry {
 	}
 }
 
+// Deletes the entries for the path or beneath it that were last scanned
+// before the cutoff, returning how many there were.
 func (filedb *FileDB) DeleteOldEntries(path string, cutoff int64) (uint64, error) {
 	filedb.mx.Lock()
 	defer filedb.mx.Unlock()
 
+	cond, args := pathCondition("Path", []string{path})
 	sql_delete := `
 	DELETE
 	FROM files
 	WHERE ScanTime < ?
-	AND Path LIKE ?
+	AND ` + cond + `
 	`
 
 	stmt, err := filedb.db.Prepare(sql_delete)
@@ -246,7 +548,7 @@ func (filedb *FileDB) DeleteOldEntries(path string, cutoff int64) (uint64, error
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(cutoff, path+"%")
+	result, err := stmt.Exec(append([]interface{}{cutoff}, args...)...)
 	if err != nil {
 		return 0, err
 	}
@@ -257,3 +559,19 @@ func (filedb *FileDB) DeleteOldEntries(path string, cutoff int64) (uint64, error
 	}
 	return uint64(rows), nil
 }
+
+// Removes the entry for a single file, e.g. after the file has been
+// deleted.  It is not an error if there is no such entry.
+func (filedb *FileDB) DeleteFileEntry(path string) error {
+	filedb.mx.Lock()
+	defer filedb.mx.Unlock()
+
+	sql_delete := `
+	DELETE
+	FROM files
+	WHERE Path=?
+	`
+
+	_, err := filedb.db.Exec(sql_delete, path)
+	return err
+}
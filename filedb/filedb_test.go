@@ -1,7 +1,11 @@
 package filedb
 
 import (
+	"database/sql"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestReadAllFileEntries(t *testing.T) {
@@ -37,13 +41,36 @@ func TestReadAllFileEntries(t *testing.T) {
 	}
 }
 
+func TestInMemoryDB(t *testing.T) {
+	db, err := InitDB(MemoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// a batch committed by a writer in the background must be visible
+	// to reads, which it wouldn't be from a second connection
+	w := db.NewWriter(1, time.Hour)
+	w.Put(*NewTestFileEntry().SetPath("/foo1.txt"))
+	w.Put(*NewTestFileEntry().SetPath("/foo2.txt"))
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allEntries, _ := db.ReadAllFileEntries()
+	if len(allEntries) != 2 || db.ReadFileEntry("/foo2.txt") == nil {
+		t.Error("wrong items, got ", allEntries)
+	}
+}
+
 func TestReadFileEntry(t *testing.T) {
 	db, _ := NewTempDB()
 	defer db.Close()
 
 	items := []*FileEntry{
 		NewTestFileEntry().SetPath("/foo1.txt"),
-		NewTestFileEntry().SetPath("/foo2.txt").SetLastMod(1).SetLength(2).SetScanTime(3).SetMd5("PQR1"),
+		NewTestFileEntry().SetPath("/foo2.txt").SetLastMod(1).SetLength(2).SetScanTime(3).SetHash("PQR1").SetDevice(4).SetInode(5),
 		NewTestFileEntry().SetPath("/foo3.txt"),
 	}
 	target := *items[1]
@@ -123,24 +150,204 @@ func TestDeletePathPrefix(t *testing.T) {
 	}
 }
 
-func TestReadEntriesByMd5(t *testing.T) {
+func TestDeleteSkipsSiblingFolders(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+
+	items := []*FileEntry{
+		NewTestFileEntry().SetPath("/data/a").SetScanTime(100),
+		NewTestFileEntry().SetPath("/data/a/x").SetScanTime(100),
+		NewTestFileEntry().SetPath("/data/ab/y").SetScanTime(100),
+		NewTestFileEntry().SetPath("/data/A/z").SetScanTime(100),
+		NewTestFileEntry().SetPath("/data/a_b/x").SetScanTime(100),
+		NewTestFileEntry().SetPath("/data/a_%/x").SetScanTime(100),
+		NewTestFileEntry().SetPath("/data/ax%/x").SetScanTime(100),
+	}
+	db.StoreFileEntries(items)
+
+	// neither case nor LIKE's wildcards should widen the match
+	deleted, _ := db.DeleteOldEntries("/data/a/", 500)
+	deleted2, _ := db.DeleteOldEntries("/data/a_%", 500)
+	var remaining []string
+	db.ProcessAllFileEntries(func(e FileEntry) {
+		remaining = append(remaining, e.Path)
+	}, "/data")
+	if deleted != 2 || deleted2 != 1 || len(remaining) != 4 || remaining[0] != "/data/A/z" || remaining[1] != "/data/a_b/x" || remaining[2] != "/data/ab/y" || remaining[3] != "/data/ax%/x" {
+		t.Error("should only have deleted beneath the folders, got ", deleted, deleted2, remaining)
+	}
+}
+
+func TestDeleteFileEntry(t *testing.T) {
 	db, _ := NewTempDB()
 	defer db.Close()
 
 	items := []*FileEntry{
 		NewTestFileEntry().SetPath("/foo1.txt"),
-		NewTestFileEntry().SetPath("/foo2.txt").SetMd5("39879ddb5f9936cee72ff46ece623183"),
+		NewTestFileEntry().SetPath("/foo2.txt"),
+	}
+	db.StoreFileEntries(items)
+
+	err := db.DeleteFileEntry("/foo1.txt")
+	if err != nil {
+		t.Error("unexpected error: ", err)
+	}
+	if db.ReadFileEntry("/foo1.txt") != nil {
+		t.Error("entry should have been deleted")
+	}
+	if db.ReadFileEntry("/foo2.txt") == nil {
+		t.Error("other entry should not have been deleted")
+	}
+
+	err = db.DeleteFileEntry("/foo1.txt")
+	if err != nil {
+		t.Error("deleting a missing entry should not fail, got ", err)
+	}
+}
+
+func TestReadEntriesByHash(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+
+	items := []*FileEntry{
+		NewTestFileEntry().SetPath("/foo1.txt"),
+		NewTestFileEntry().SetPath("/foo2.txt").SetHash("39879ddb5f9936cee72ff46ece623183"),
 		NewTestFileEntry().SetPath("/foo3.txt"),
 	}
 	db.StoreFileEntries(items)
 
-	items1, _ := db.ReadFileEntriesByKnownFileKey(items[0].Md5, items[0].Length)
+	items1, _ := db.ReadFileEntriesByKnownFileKey(items[0].HashAlg, items[0].Hash, items[0].Length)
 	if len(items1) != 2 {
 		t.Error("wrong number of items, got", len(items1))
 	}
 
-	items2, _ := db.ReadFileEntriesByKnownFileKey(items[1].Md5, items[1].Length)
+	items2, _ := db.ReadFileEntriesByKnownFileKey(items[1].HashAlg, items[1].Hash, items[1].Length)
 	if len(items2) != 1 {
 		t.Error("wrong number of items, got", len(items2))
 	}
+
+	items3, _ := db.ReadFileEntriesByKnownFileKey("sha256", items[0].Hash, items[0].Length)
+	if len(items3) != 0 {
+		t.Error("wrong number of items, got", len(items3))
+	}
+}
+
+func TestReadFileEntriesNeedingHashes(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+
+	items := []*FileEntry{
+		NewTestFileEntry().SetPath("/foo1.txt").SetLength(1).SetPartialHash("").SetHash(""),
+		NewTestFileEntry().SetPath("/foo2.txt").SetLength(2).SetPartialHash("").SetHash(""),
+		NewTestFileEntry().SetPath("/foo3.txt").SetLength(2).SetPartialHash("").SetHash(""),
+		NewTestFileEntry().SetPath("/foo4.txt").SetLength(3).SetPartialHash("P1").SetHash(""),
+		NewTestFileEntry().SetPath("/foo5.txt").SetLength(3).SetPartialHash("P1").SetHash(""),
+		NewTestFileEntry().SetPath("/foo6.txt").SetLength(3).SetPartialHash("P2").SetHash(""),
+	}
+	db.StoreFileEntries(items)
+
+	lengths, _ := db.ReadCollidingLengths("/")
+	if len(lengths) != 2 || lengths[0] != 2 || lengths[1] != 3 {
+		t.Error("wrong colliding lengths, got ", lengths)
+	}
+	partial, _ := db.ReadFileEntriesNeedingPartialHash("md5", lengths)
+	if len(partial) != 2 || partial[0].Path != "/foo2.txt" || partial[1].Path != "/foo3.txt" {
+		t.Error("wrong entries needing partial hash, got ", partial)
+	}
+
+	keys, _ := db.ReadCollidingPartialHashes("md5", "/")
+	if len(keys) != 1 || keys[0] != (PartialHashKey{3, "P1"}) {
+		t.Error("wrong colliding partial hashes, got ", keys)
+	}
+	full, _ := db.ReadFileEntriesNeedingFullHash("md5", keys)
+	if len(full) != 2 || full[0].Path != "/foo4.txt" || full[1].Path != "/foo5.txt" {
+		t.Error("wrong entries needing full hash, got ", full)
+	}
+
+	// a few keys at a time
+	partial, _ = db.ReadFileEntriesNeedingPartialHash("md5", lengths[1:])
+	if len(partial) != 0 {
+		t.Error("wrong entries needing partial hash, got ", partial)
+	}
+	partial, _ = db.ReadFileEntriesNeedingPartialHash("md5", nil)
+	if len(partial) != 0 {
+		t.Error("no lengths should read no entries, got ", partial)
+	}
+
+	// with another algorithm
+	keys, _ = db.ReadCollidingPartialHashes("sha256", "/")
+	if len(keys) != 0 {
+		t.Error("partial hashes from another algorithm should be left out, got ", keys)
+	}
+	full, _ = db.ReadFileEntriesNeedingFullHash("sha256", []PartialHashKey{{3, "P1"}})
+	if len(full) != 0 {
+		t.Error("entries hashed with another algorithm should be left out, got ", full)
+	}
+}
+
+func TestReadFileEntriesNeedingHashesAgainstEarlierScans(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+
+	items := []*FileEntry{
+		NewTestFileEntry().SetPath("/a/foo1.txt").SetLength(1).SetPartialHash("").SetHash(""),
+		NewTestFileEntry().SetPath("/b/foo1.txt").SetLength(1).SetPartialHash("").SetHash(""),
+		NewTestFileEntry().SetPath("/c/foo3.txt").SetLength(3).SetPartialHash("").SetHash(""),
+		NewTestFileEntry().SetPath("/d/foo3.txt").SetLength(3).SetPartialHash("").SetHash(""),
+		NewTestFileEntry().SetPath("/a/foo2.txt").SetLength(2).SetPartialHash("P1").SetHash(""),
+		NewTestFileEntry().SetPath("/b/foo2.txt").SetLength(2).SetPartialHash("P1").SetHash(""),
+		NewTestFileEntry().SetPath("/c/foo2.txt").SetLength(2).SetPartialHash("P2").SetHash(""),
+		NewTestFileEntry().SetPath("/d/foo2.txt").SetLength(2).SetPartialHash("P2").SetHash(""),
+	}
+	db.StoreFileEntries(items)
+
+	// /b was scanned after /a, so the files in both are hashed, but
+	// not those of other lengths that only collide elsewhere
+	lengths, _ := db.ReadCollidingLengths("/b/")
+	partial, _ := db.ReadFileEntriesNeedingPartialHash("md5", lengths)
+	if len(partial) != 2 || partial[0].Path != "/a/foo1.txt" || partial[1].Path != "/b/foo1.txt" {
+		t.Error("wrong entries needing partial hash, got ", partial)
+	}
+	keys, _ := db.ReadCollidingPartialHashes("md5", "/b/")
+	full, _ := db.ReadFileEntriesNeedingFullHash("md5", keys)
+	if len(full) != 2 || full[0].Path != "/a/foo2.txt" || full[1].Path != "/b/foo2.txt" {
+		t.Error("wrong entries needing full hash, got ", full)
+	}
+	keys, _ = db.ReadCollidingPartialHashes("md5", "/e/")
+	if len(keys) != 0 {
+		t.Error("wrong colliding partial hashes, got ", keys)
+	}
+}
+
+func TestInitDBUpgradesOldSchema(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "db")
+	defer os.RemoveAll(dir)
+	dbpath := dir + "/old.db"
+
+	old, _ := sql.Open("sqlite3", dbpath)
+	_, err := old.Exec(`
+	CREATE TABLE files(
+		Path TEXT NOT NULL PRIMARY KEY,
+		Length INT NOT NULL,
+		LastMod INT NOT NULL,
+		Md5 TEXT NOT NULL,
+		ScanTime INT NOT NULL
+	);
+	INSERT INTO files VALUES('/foo1.txt', 1, 2, 'ABC', 3);
+	`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := InitDB(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expected := FileEntry{Path: "/foo1.txt", Length: 1, LastMod: 2, HashAlg: "md5", Hash: "ABC", ScanTime: 3}
+	fileEntry := db.ReadFileEntry("/foo1.txt")
+	if fileEntry == nil || *fileEntry != expected {
+		t.Error("bad value, expected=", expected, ", got=", fileEntry)
+	}
 }
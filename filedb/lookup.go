@@ -0,0 +1,165 @@
+package filedb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"lostbearlabs.com/ddet/hashing"
+	"os"
+	"strings"
+)
+
+// The entries found by looking up some contents in the FileDB.
+type LookupResult struct {
+	// files with the same length and hash
+	Matches []FileEntry
+	// files with the same length that haven't been fully hashed, and
+	// couldn't be hashed now since they have changed or gone since they
+	// were scanned, so it isn't known whether they match
+	Unknown []FileEntry
+}
+
+// Returns true if some file in the FileDB has the same contents.
+func (r *LookupResult) Found() bool {
+	return len(r.Matches) > 0
+}
+
+// Looks up a file that may not be in the FileDB, e.g. one that hasn't
+// been stored yet, returning the entries for files with the same
+// contents.  The file is hashed with each algorithm used by the entries
+// for files of its length, all in a single read, and is not read at all
+// if there are none.  Entries of that length that haven't been fully
+// hashed are hashed first, as for LookupHash().
+func (filedb *FileDB) LookupFile(path string) (*LookupResult, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", path)
+	}
+	candidates, err := filedb.readCandidates(fi.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]hash.Hash)
+	for _, e := range candidates {
+		if e.Hash == "" || hashes[e.HashAlg] != nil {
+			continue
+		}
+		hasher, err := hashing.Lookup(e.HashAlg)
+		if err != nil {
+			return nil, err
+		}
+		hashes[e.HashAlg] = hasher.New()
+	}
+	digests, err := hashFile(path, hashes)
+	if err != nil {
+		return nil, err
+	}
+	logger.Tracef("%s has %d candidates, hashed with %d algorithms", path, len(candidates), len(digests))
+
+	return lookup(candidates, func(e FileEntry) bool {
+		return e.Hash == digests[e.HashAlg]
+	}), nil
+}
+
+// Looks up contents by their hash and length alone, returning the
+// entries for files with the same contents.  The hash is in hex, and
+// matches files hashed with any algorithm unless hashAlg is given.
+// Entries of that length that haven't been fully hashed, since nothing
+// scanned with them shared their length and partial hash, are hashed
+// and stored first, unless their files have changed since they were
+// scanned.
+func (filedb *FileDB) LookupHash(hashAlg string, hash string, length int64) (*LookupResult, error) {
+	candidates, err := filedb.readCandidates(length)
+	if err != nil {
+		return nil, err
+	}
+	hash = strings.ToLower(hash)
+	return lookup(candidates, func(e FileEntry) bool {
+		return e.Hash == hash && (hashAlg == "" || e.HashAlg == hashAlg)
+	}), nil
+}
+
+// Returns the entries for files of the specified length, computing and
+// storing the hashes of those that haven't been fully hashed and whose
+// files are unchanged since they were scanned.
+func (filedb *FileDB) readCandidates(length int64) ([]FileEntry, error) {
+	candidates, err := filedb.ReadFileEntriesByLength(length)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashed []*FileEntry
+	for i := range candidates {
+		e := &candidates[i]
+		if e.Hash != "" {
+			continue
+		}
+		fi, err := os.Stat(e.Path)
+		if err != nil || !fi.Mode().IsRegular() || fi.Size() != e.Length || fi.ModTime().Unix() != e.LastMod {
+			logger.Tracef("not hashing %s, it has changed since it was scanned", e.Path)
+			continue
+		}
+		hasher, err := hashing.Lookup(e.HashAlg)
+		if err != nil {
+			return nil, err
+		}
+		digests, err := hashFile(e.Path, map[string]hash.Hash{e.HashAlg: hasher.New()})
+		if err != nil {
+			logger.Warningf("unable to read file %s: %v", e.Path, err)
+			continue
+		}
+		e.SetHash(digests[e.HashAlg])
+		hashed = append(hashed, e)
+	}
+	if len(hashed) > 0 {
+		err = filedb.StoreFileEntries(hashed)
+	}
+	return candidates, err
+}
+
+// Sorts the entries for files of the right length into those that match
+// and those whose contents aren't known.
+func lookup(candidates []FileEntry, matches func(FileEntry) bool) *LookupResult {
+	result := &LookupResult{}
+	for _, e := range candidates {
+		switch {
+		case e.Hash == "":
+			result.Unknown = append(result.Unknown, e)
+		case matches(e):
+			result.Matches = append(result.Matches, e)
+		}
+	}
+	return result
+}
+
+// Reads the file once, feeding it to each of the hashes, and returns
+// their sums in hex by algorithm name.
+func hashFile(path string, hashes map[string]hash.Hash) (map[string]string, error) {
+	digests := make(map[string]string)
+	if len(hashes) == 0 {
+		return digests, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return nil, err
+	}
+	for name, h := range hashes {
+		digests[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return digests, nil
+}
@@ -0,0 +1,113 @@
+package filedb
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLookupFile(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "lookup")
+	defer os.RemoveAll(dir)
+	contents := []byte("constant text string 1")
+	path := dir + "/upload"
+	ioutil.WriteFile(path, contents, 0644)
+
+	md5Sum := md5.Sum(contents)
+	sha256Sum := sha256.Sum256(contents)
+	length := int64(len(contents))
+
+	// an indexed copy that wasn't hashed when it was scanned
+	indexed := dir + "/indexed"
+	ioutil.WriteFile(indexed, contents, 0644)
+	fi, _ := os.Stat(indexed)
+
+	db, _ := NewTempDB()
+	defer db.Close()
+	db.StoreFileEntries([]*FileEntry{
+		NewTestFileEntry().SetPath("/a/same-md5").SetLength(length).SetHash(hex.EncodeToString(md5Sum[:])),
+		NewTestFileEntry().SetPath("/a/same-sha256").SetLength(length).SetHashAlg("sha256").SetHash(hex.EncodeToString(sha256Sum[:])),
+		NewTestFileEntry().SetPath("/a/different").SetLength(length).SetHash("abcd"),
+		NewTestFileEntry().SetPath("/a/unhashed").SetLength(length).SetHash(""),
+		NewTestFileEntry().SetPath(indexed).SetLength(length).SetLastMod(fi.ModTime().Unix()).SetHash("").SetPartialHash(""),
+		NewTestFileEntry().SetPath("/a/other-length").SetLength(length + 1).SetHash(hex.EncodeToString(md5Sum[:])),
+	})
+
+	result, err := db.LookupFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Found() || len(result.Matches) != 3 || result.Matches[0].Path != "/a/same-md5" || result.Matches[1].Path != "/a/same-sha256" || result.Matches[2].Path != indexed {
+		t.Error("wrong matches, got ", result.Matches)
+	}
+	// the entry without a file can't be hashed
+	if len(result.Unknown) != 1 || result.Unknown[0].Path != "/a/unhashed" {
+		t.Error("wrong unknown entries, got ", result.Unknown)
+	}
+	if e := db.ReadFileEntry(indexed); e.Hash != hex.EncodeToString(md5Sum[:]) {
+		t.Error("the hash of the indexed copy should have been stored, got ", e)
+	}
+
+	ioutil.WriteFile(path, []byte("something else"), 0644)
+	result, err = db.LookupFile(path)
+	if err != nil || result.Found() || len(result.Unknown) != 0 {
+		t.Error("a file of another length should match nothing, got ", result, err)
+	}
+
+	_, err = db.LookupFile(dir + "/missing")
+	if err == nil {
+		t.Error("a missing file should be an error")
+	}
+}
+
+func TestLookupHash(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+	db.StoreFileEntries([]*FileEntry{
+		NewTestFileEntry().SetPath("/a/md5").SetLength(10).SetHash("abcd"),
+		NewTestFileEntry().SetPath("/a/sha256").SetLength(10).SetHashAlg("sha256").SetHash("abcd"),
+		NewTestFileEntry().SetPath("/a/other-length").SetLength(11).SetHash("abcd"),
+	})
+
+	result, _ := db.LookupHash("", "ABCD", 10)
+	if len(result.Matches) != 2 {
+		t.Error("the hash should match files hashed with any algorithm, got ", result.Matches)
+	}
+	result, _ = db.LookupHash("sha256", "abcd", 10)
+	if len(result.Matches) != 1 || result.Matches[0].Path != "/a/sha256" {
+		t.Error("the hash should only match files hashed with the algorithm, got ", result.Matches)
+	}
+	result, _ = db.LookupHash("", "abcd", 12)
+	if result.Found() {
+		t.Error("the length should have to match, got ", result.Matches)
+	}
+}
+
+func TestLookupHashOfUnhashedFile(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "lookup")
+	defer os.RemoveAll(dir)
+	contents := []byte("constant text string 1")
+	path := dir + "/indexed"
+	ioutil.WriteFile(path, contents, 0644)
+	fi, _ := os.Stat(path)
+	md5Sum := md5.Sum(contents)
+	length := int64(len(contents))
+
+	db, _ := NewTempDB()
+	defer db.Close()
+	db.StoreFileEntries([]*FileEntry{
+		NewTestFileEntry().SetPath(path).SetLength(length).SetLastMod(fi.ModTime().Unix()).SetHash(""),
+		NewTestFileEntry().SetPath(dir + "/changed").SetLength(length).SetHash(""),
+	})
+
+	result, _ := db.LookupHash("md5", hex.EncodeToString(md5Sum[:]), length)
+	if len(result.Matches) != 1 || result.Matches[0].Path != path {
+		t.Error("the unhashed file should have been hashed and matched, got ", result.Matches)
+	}
+	if len(result.Unknown) != 1 || result.Unknown[0].Path != dir+"/changed" {
+		t.Error("wrong unknown entries, got ", result.Unknown)
+	}
+}
@@ -0,0 +1,116 @@
+package filedb
+
+import (
+	"time"
+)
+
+const DefaultBatchSize = 10000
+const DefaultBatchInterval = time.Second
+
+// A request to the writer goroutine:  either an entry to store or,
+// if flushed is set, a request to commit everything received so far.
+type writeRequest struct {
+	item    FileEntry
+	flushed chan error
+}
+
+// A Writer accepts FileEntry updates from any number of goroutines and
+// stores them from a single goroutine, committing them in large
+// transactions rather than one at a time.  A batch is committed once it
+// reaches the batch size or once the batch interval has passed,
+// whichever comes first.
+//
+// A Writer should be acquired via FileDB.NewWriter() and *must* be
+// closed by calling Close(), which returns only once every entry has
+// been committed.  Put() must not be called after Close().
+type Writer struct {
+	filedb    *FileDB
+	requests  chan writeRequest
+	done      chan error
+	batchSize int
+	interval  time.Duration
+}
+
+func (filedb *FileDB) NewWriter(batchSize int, interval time.Duration) *Writer {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+	w := &Writer{
+		filedb:    filedb,
+		requests:  make(chan writeRequest, batchSize),
+		done:      make(chan error),
+		batchSize: batchSize,
+		interval:  interval,
+	}
+	go w.run()
+	return w
+}
+
+// Queues an entry to be stored.  Blocks if the writer has fallen a full
+// batch behind.
+func (w *Writer) Put(item FileEntry) {
+	w.requests <- writeRequest{item: item}
+}
+
+// Blocks until every entry queued before this call has been committed.
+// Returns the first error encountered by the writer, if any.
+func (w *Writer) Flush() error {
+	flushed := make(chan error)
+	w.requests <- writeRequest{flushed: flushed}
+	return <-flushed
+}
+
+// Commits any remaining entries and stops the writer goroutine.  Returns
+// the first error encountered by the writer, if any.
+func (w *Writer) Close() error {
+	close(w.requests)
+	return <-w.done
+}
+
+func (w *Writer) run() {
+	var firstErr error
+	batch := make([]*FileEntry, 0, w.batchSize)
+
+	commit := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := w.filedb.StoreFileEntries(batch)
+		if err != nil {
+			logger.Errorf("Error [%v] storing batch of %d entries", err, len(batch))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		batch = make([]*FileEntry, 0, w.batchSize)
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case req, ok := <-w.requests:
+			switch {
+			case !ok:
+				commit()
+				w.done <- firstErr
+				return
+			case req.flushed != nil:
+				commit()
+				req.flushed <- firstErr
+			default:
+				item := req.item
+				batch = append(batch, &item)
+				if len(batch) >= w.batchSize {
+					commit()
+				}
+			}
+		case <-ticker.C:
+			commit()
+		}
+	}
+}
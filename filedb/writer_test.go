@@ -0,0 +1,70 @@
+package filedb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWriterCloseCommitsEverything(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+
+	w := db.NewWriter(7, time.Hour)
+	for i := 0; i < 100; i++ {
+		w.Put(*NewTestFileEntry().SetPath(fmt.Sprintf("/foo%03d.txt", i)))
+	}
+	err := w.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	allEntries, _ := db.ReadAllFileEntries()
+	if len(allEntries) != 100 {
+		t.Error("wrong number of items, got ", len(allEntries))
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+
+	w := db.NewWriter(1000, time.Hour)
+	defer w.Close()
+
+	w.Put(*NewTestFileEntry().SetPath("/foo1.txt"))
+	w.Put(*NewTestFileEntry().SetPath("/foo2.txt"))
+
+	allEntries, _ := db.ReadAllFileEntries()
+	if len(allEntries) != 0 {
+		t.Error("batch should not have been committed yet, got ", len(allEntries))
+	}
+
+	err := w.Flush()
+	if err != nil {
+		t.Error(err)
+	}
+
+	allEntries, _ = db.ReadAllFileEntries()
+	if len(allEntries) != 2 {
+		t.Error("wrong number of items, got ", len(allEntries))
+	}
+}
+
+func TestWriterCommitsAfterInterval(t *testing.T) {
+	db, _ := NewTempDB()
+	defer db.Close()
+
+	w := db.NewWriter(1000, 10*time.Millisecond)
+	defer w.Close()
+
+	w.Put(*NewTestFileEntry().SetPath("/foo1.txt"))
+
+	for i := 0; i < 100; i++ {
+		if db.ReadFileEntry("/foo1.txt") != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("entry was never committed")
+}
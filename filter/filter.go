@@ -0,0 +1,198 @@
+package filter
+
+import (
+	"github.com/juju/loggo"
+	"lostbearlabs.com/ddet/util"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var logger = loggo.GetLogger("filter")
+
+// A Filter decides which files are of interest, based on glob patterns
+// matched against their paths.  A file is of interest if it matches no
+// exclude pattern and, when there are any include patterns, matches at
+// least one of them.
+//
+// Patterns are matched against path components, using the syntax of
+// path.Match within each component, plus "**" which matches any number
+// of whole components (including none).  A pattern starting with "/" is
+// matched against the whole path;  any other pattern may match any
+// trailing part of the path, so "node_modules" matches a directory of
+// that name anywhere and "build/*.o" matches object files in any
+// "build" directory.  A pattern that matches a directory also matches
+// everything beneath it.  Once the folders being scanned or analyzed are
+// given to SetRoots, patterns not starting with "/" are only matched
+// against the part of a path beneath its folder, so that "build" doesn't
+// leave out everything in a folder named /tmp/build.
+//
+// A Filter may also limit the sizes of files of interest;  see MatchSize.
+//
+// The zero Filter, like New(), has no patterns or size limits and matches
+// every file.
+type Filter struct {
+	excludes []pattern
+	includes []pattern
+	minSize  int64
+	maxSize  int64
+	roots    []string
+}
+
+func New() *Filter {
+	return &Filter{}
+}
+
+// Adds a pattern for paths to be left out.
+func (f *Filter) Exclude(glob string) error {
+	p, err := newPattern(glob)
+	if err != nil {
+		return err
+	}
+	f.excludes = append(f.excludes, p)
+	return nil
+}
+
+// Adds a pattern for paths to be kept.  Once any include pattern has
+// been added, files that match none of them are left out.
+func (f *Filter) Include(glob string) error {
+	p, err := newPattern(glob)
+	if err != nil {
+		return err
+	}
+	f.includes = append(f.includes, p)
+	return nil
+}
+
+// Sets the folders being scanned or analyzed.  Patterns that don't start
+// with "/" never match these folders or their ancestors.
+func (f *Filter) SetRoots(roots ...string) {
+	f.roots = nil
+	for _, root := range roots {
+		f.roots = append(f.roots, filepath.Clean(root))
+	}
+}
+
+// Returns the number of components of the deepest root that the path is
+// in, or 0 if it is in none of them.
+func (f *Filter) rootDepth(p string) int {
+	depth := 0
+	for _, root := range f.roots {
+		if util.IsWithin(p, root) {
+			if n := len(splitPath(root)); n > depth {
+				depth = n
+			}
+		}
+	}
+	return depth
+}
+
+// Returns true if the directory is excluded, i.e. nothing beneath it
+// can be of interest.
+func (f *Filter) SkipDir(dir string) bool {
+	if f == nil {
+		return false
+	}
+	components, depth := splitPath(dir), f.rootDepth(dir)
+	for _, p := range f.excludes {
+		if p.matchesAncestorOrSelf(components, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the file is of interest.
+func (f *Filter) MatchFile(file string) bool {
+	if f == nil {
+		return true
+	}
+	components, depth := splitPath(file), f.rootDepth(file)
+	for _, p := range f.excludes {
+		if p.matchesAncestorOrSelf(components, depth) {
+			return false
+		}
+	}
+	if len(f.includes) == 0 {
+		return true
+	}
+	for _, p := range f.includes {
+		if p.matchesAncestorOrSelf(components, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+// A glob pattern, split into components.
+type pattern struct {
+	components []string
+	anchored   bool
+}
+
+func newPattern(glob string) (pattern, error) {
+	glob = filepath.ToSlash(glob)
+	anchored := strings.HasPrefix(glob, "/")
+	components := splitPath(glob)
+	if !anchored {
+		components = append([]string{"**"}, components...)
+	}
+	for _, c := range components {
+		if _, err := path.Match(c, ""); err != nil {
+			return pattern{}, err
+		}
+	}
+	return pattern{components, anchored}, nil
+}
+
+// Splits a path into its non-empty components.
+func splitPath(p string) []string {
+	var components []string
+	for _, c := range strings.Split(filepath.ToSlash(p), "/") {
+		if c != "" {
+			components = append(components, c)
+		}
+	}
+	return components
+}
+
+// Returns true if the pattern matches the path or any of its ancestors
+// beneath its root, which has the given number of components.  Unless
+// the pattern is anchored, the root's own components are left out of
+// the match.
+func (p pattern) matchesAncestorOrSelf(components []string, depth int) bool {
+	start := depth
+	if p.anchored {
+		start = 0
+	}
+	for n := len(components); n > depth; n-- {
+		if matchComponents(p.components, components[start:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchComponents(pat []string, components []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// try matching the rest of the pattern at every position
+			for i := 0; i <= len(components); i++ {
+				if matchComponents(pat[1:], components[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(components) == 0 {
+			return false
+		}
+		ok, _ := path.Match(pat[0], components[0])
+		if !ok {
+			return false
+		}
+		pat = pat[1:]
+		components = components[1:]
+	}
+	return len(components) == 0
+}
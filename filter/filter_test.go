@@ -0,0 +1,121 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestEmptyFilterMatchesEverything(t *testing.T) {
+	f := New()
+	if !f.MatchFile("/a/b/c.txt") {
+		t.Error("should have matched")
+	}
+	if f.SkipDir("/a/b") {
+		t.Error("should not have skipped")
+	}
+}
+
+func TestExcludeName(t *testing.T) {
+	f := New()
+	f.Exclude("node_modules")
+	f.Exclude("*.tmp")
+
+	cases := map[string]bool{
+		"/src/app/main.js":                  true,
+		"/src/app/node_modules/x/index.js":  false,
+		"/src/node_modules":                 false,
+		"/src/app/cache.tmp":                false,
+		"/src/app.tmp/cache":                false,
+		"/src/app/node_modules_old/main.js": true,
+	}
+	for path, expected := range cases {
+		if f.MatchFile(path) != expected {
+			t.Error("wrong result for ", path, ", expected=", expected)
+		}
+	}
+
+	if !f.SkipDir("/src/app/node_modules") {
+		t.Error("should have skipped directory")
+	}
+	if f.SkipDir("/src/app") {
+		t.Error("should not have skipped directory")
+	}
+}
+
+func TestExcludeWithDoubleStar(t *testing.T) {
+	f := New()
+	f.Exclude(".git/**/objects")
+	f.Exclude("/var/**/cache")
+
+	cases := map[string]bool{
+		"/src/.git/objects/ab/cdef":        false,
+		"/src/.git/modules/x/objects/abcd": false,
+		"/src/.git/config":                 true,
+		"/var/lib/apt/cache/x.deb":         false,
+		"/var/cache/x":                     false,
+		"/home/var/cache/x":                true,
+	}
+	for path, expected := range cases {
+		if f.MatchFile(path) != expected {
+			t.Error("wrong result for ", path, ", expected=", expected)
+		}
+	}
+}
+
+func TestExcludeNameOfRoot(t *testing.T) {
+	f := New()
+	f.Exclude("build")
+	f.Exclude("/tmp/build/keep/*.o")
+	f.SetRoots("/tmp/build/", "/src")
+
+	cases := map[string]bool{
+		"/tmp/build/main.c":       true,
+		"/tmp/build/out/build/x":  false,
+		"/tmp/build/keep/main.o":  false,
+		"/src/build/main.o":       false,
+		"/other/build/main.o":     false,
+		"/tmp/buildings/main.c":   true,
+		"/tmp/build2/build/x.txt": false,
+	}
+	for path, expected := range cases {
+		if f.MatchFile(path) != expected {
+			t.Error("wrong result for ", path, ", expected=", expected)
+		}
+	}
+
+	if f.SkipDir("/tmp/build/out") {
+		t.Error("should not have skipped directory")
+	}
+	if !f.SkipDir("/tmp/build/out/build") {
+		t.Error("should have skipped directory")
+	}
+}
+
+func TestInclude(t *testing.T) {
+	f := New()
+	f.Include("*.jpg")
+	f.Include("docs")
+	f.Exclude("thumbs")
+
+	cases := map[string]bool{
+		"/photos/a.jpg":        true,
+		"/photos/a.png":        false,
+		"/photos/thumbs/a.jpg": false,
+		"/docs/a.png":          true,
+	}
+	for path, expected := range cases {
+		if f.MatchFile(path) != expected {
+			t.Error("wrong result for ", path, ", expected=", expected)
+		}
+	}
+
+	if f.SkipDir("/photos") {
+		t.Error("includes should not skip directories")
+	}
+}
+
+func TestBadPattern(t *testing.T) {
+	f := New()
+	if f.Exclude("[a-") == nil {
+		t.Error("should have failed for bad pattern")
+	}
+}
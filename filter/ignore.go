@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"bufio"
+	"lostbearlabs.com/ddet/util"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the per-directory ignore file honored by default.
+const DdetIgnore = ".ddetignore"
+
+// The name of git's per-directory ignore file.
+const GitIgnore = ".gitignore"
+
+// An IgnoreStack holds the rules from the ignore files found as a walk
+// descends through a tree.  Ignore files use the same syntax as git's
+// .gitignore files:
+//   - blank lines and lines starting with "#" are skipped
+//   - a pattern starting with "!" re-includes paths that an earlier
+//     pattern ignored
+//   - a pattern ending with "/" only matches directories
+//   - a pattern with a "/" at the start or in the middle is matched
+//     against the path relative to the ignore file's directory;  any
+//     other pattern may match at any depth beneath that directory
+//   - "*", "?", "[...]" and "**" work as they do for a Filter
+//
+// The last matching rule wins, and rules from a deeper directory come
+// after those from its parents, so nested ignore files override their
+// parents.
+type IgnoreStack struct {
+	names  []string
+	frames []ignoreFrame
+}
+
+// The rules loaded from the ignore files in one directory.
+type ignoreFrame struct {
+	dir   string
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	components []string
+	negate     bool
+	dirOnly    bool
+}
+
+// Creates an IgnoreStack that loads ignore files with the given names,
+// e.g. DdetIgnore.  Files are loaded in the order given, so rules from
+// later names override rules from earlier ones.
+func NewIgnoreStack(names ...string) *IgnoreStack {
+	return &IgnoreStack{names: names}
+}
+
+// Called as the walk enters a directory, to load its ignore files.
+// Rules from directories that are not ancestors of dir are dropped.
+func (s *IgnoreStack) EnterDir(dir string) {
+	if s == nil || len(s.names) == 0 {
+		return
+	}
+	for len(s.frames) > 0 && !util.IsWithin(dir, s.frames[len(s.frames)-1].dir) {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+
+	var rules []ignoreRule
+	for _, name := range s.names {
+		loaded, err := loadIgnoreFile(filepath.Join(dir, name))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warningf("unable to read ignore file %s: %v", filepath.Join(dir, name), err)
+			}
+			continue
+		}
+		rules = append(rules, loaded...)
+	}
+	if len(rules) > 0 {
+		s.frames = append(s.frames, ignoreFrame{dir, rules})
+	}
+}
+
+// Returns true if the rules in effect ignore the path.
+func (s *IgnoreStack) Ignored(path string, isDir bool) bool {
+	if s == nil {
+		return false
+	}
+	ignored := false
+	for _, frame := range s.frames {
+		if !util.IsWithin(path, frame.dir) || path == frame.dir {
+			continue
+		}
+		rel, err := filepath.Rel(frame.dir, path)
+		if err != nil {
+			continue
+		}
+		components := splitPath(rel)
+		for _, rule := range frame.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if matchComponents(rule.components, components) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func loadIgnoreFile(name string) ([]ignoreRule, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		rule, ok := parseIgnoreLine(lines.Text())
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, lines.Err()
+}
+
+// Parses one line of an ignore file, returning false if the line holds
+// no pattern.
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+
+	anchored := strings.Contains(line, "/")
+	rule.components = splitPath(line)
+	if !anchored {
+		rule.components = append([]string{"**"}, rule.components...)
+	}
+	for _, c := range rule.components {
+		if _, err := pathpkg.Match(c, ""); err != nil {
+			logger.Warningf("skipping bad ignore pattern %q: %v", line, err)
+			return rule, false
+		}
+	}
+	return rule, true
+}
@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeIgnoreFile(dir string, lines string) {
+	os.MkdirAll(dir, 0755)
+	ioutil.WriteFile(dir+"/"+DdetIgnore, []byte(lines), 0644)
+}
+
+func TestIgnoreSemantics(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	writeIgnoreFile(dir, `
+# comment
+*.log
+!keep.log
+/top.txt
+build/
+docs/*.pdf
+\#hash
+`)
+
+	s := NewIgnoreStack(DdetIgnore)
+	s.EnterDir(dir)
+
+	cases := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"/a.log", false, true},
+		{"/sub/a.log", false, true},
+		{"/sub/keep.log", false, false},
+		{"/top.txt", false, true},
+		{"/sub/top.txt", false, false},
+		{"/build", true, true},
+		{"/sub/build", true, true},
+		{"/build", false, false},
+		{"/docs/a.pdf", false, true},
+		{"/sub/docs/a.pdf", false, false},
+		{"/#hash", false, true},
+		{"/comment", false, false},
+	}
+	for _, c := range cases {
+		if s.Ignored(dir+c.path, c.isDir) != c.expected {
+			t.Error("wrong result for ", c.path, ", expected=", c.expected)
+		}
+	}
+}
+
+func TestNestedIgnoreFilesOverrideParents(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	writeIgnoreFile(dir, "*.tmp\n")
+	writeIgnoreFile(dir+"/a", "!*.tmp\n")
+	os.MkdirAll(dir+"/b", 0755)
+
+	s := NewIgnoreStack(DdetIgnore)
+	s.EnterDir(dir)
+	if !s.Ignored(dir+"/x.tmp", false) {
+		t.Error("should have ignored file at top level")
+	}
+
+	s.EnterDir(dir + "/a")
+	if s.Ignored(dir+"/a/x.tmp", false) {
+		t.Error("nested ignore file should have re-included file")
+	}
+
+	s.EnterDir(dir + "/b")
+	if !s.Ignored(dir+"/b/x.tmp", false) {
+		t.Error("sibling ignore file should no longer apply")
+	}
+}
+
+func TestIgnoreStackWithoutNamesIgnoresNothing(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	writeIgnoreFile(dir, "*\n")
+
+	s := NewIgnoreStack()
+	s.EnterDir(dir)
+	if s.Ignored(dir+"/x.tmp", false) {
+		t.Error("should not have loaded any ignore file")
+	}
+}
@@ -0,0 +1,59 @@
+package filter
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = map[byte]int64{
+	'K': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+	'T': 1 << 40,
+	'P': 1 << 50,
+}
+
+// Parses a size in bytes, optionally followed by a binary unit:  K, M,
+// G, T, or P, e.g. "512", "64K", "1.5G".  Units are case-insensitive and
+// may be followed by "B" or "iB", so "2GB" and "2GiB" also work.
+func ParseSize(s string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(text); n > 0 {
+		if m, ok := sizeUnits[text[n-1]]; ok {
+			multiplier = m
+			text = text[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	size := value * float64(multiplier)
+	// NaN fails every comparison, so it is left out by the last one
+	if err != nil || !(size >= 0 && size < math.MaxInt64) {
+		return 0, errors.New("bad size: " + s)
+	}
+	return int64(size), nil
+}
+
+// Leaves out files smaller than the given number of bytes.
+func (f *Filter) SetMinSize(size int64) {
+	f.minSize = size
+}
+
+// Leaves out files larger than the given number of bytes.  Zero means
+// there is no maximum.
+func (f *Filter) SetMaxSize(size int64) {
+	f.maxSize = size
+}
+
+// Returns true if a file of the given length is of interest.
+func (f *Filter) MatchSize(length int64) bool {
+	if f == nil {
+		return true
+	}
+	return length >= f.minSize && (f.maxSize == 0 || length <= f.maxSize)
+}
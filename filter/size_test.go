@@ -0,0 +1,59 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"0":     0,
+		"512":   512,
+		"64K":   64 * 1024,
+		"64k":   64 * 1024,
+		"1M":    1024 * 1024,
+		"2G":    2 * 1024 * 1024 * 1024,
+		"2GB":   2 * 1024 * 1024 * 1024,
+		"2GiB":  2 * 1024 * 1024 * 1024,
+		"1.5K":  1536,
+		" 3T ":  3 << 40,
+		"100B":  100,
+		"0.5PB": 1 << 49,
+	}
+	for text, expected := range cases {
+		size, err := ParseSize(text)
+		if err != nil {
+			t.Error("failed for ", text, ": ", err)
+		}
+		if size != expected {
+			t.Error("wrong size for ", text, ", expected=", expected, ", got=", size)
+		}
+	}
+
+	for _, text := range []string{"", "M", "-1K", "1X", "abc", "inf", "+Inf", "-inf", "NaN", "nanK", "1e300", "9000000P", "9223372036854775808"} {
+		_, err := ParseSize(text)
+		if err == nil {
+			t.Error("should have failed for ", text)
+		}
+	}
+}
+
+func TestMatchSize(t *testing.T) {
+	f := New()
+	if !f.MatchSize(1) || !f.MatchSize(1<<40) {
+		t.Error("empty filter should match any size")
+	}
+
+	f.SetMinSize(10)
+	f.SetMaxSize(20)
+	cases := map[int64]bool{
+		9:  false,
+		10: true,
+		20: true,
+		21: false,
+	}
+	for size, expected := range cases {
+		if f.MatchSize(size) != expected {
+			t.Error("wrong result for ", size, ", expected=", expected)
+		}
+	}
+}
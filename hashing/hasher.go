@@ -0,0 +1,69 @@
+package hashing
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"github.com/cespare/xxhash"
+	"github.com/zeebo/blake3"
+	"hash"
+	"sort"
+)
+
+// A Hasher is a named algorithm for hashing file contents.  The name is
+// stored alongside every hash in the FileDB, so that hashes computed by
+// different algorithms are never compared with each other.
+type Hasher interface {
+	Name() string
+	New() hash.Hash
+}
+
+type namedHasher struct {
+	name    string
+	newHash func() hash.Hash
+}
+
+func (h namedHasher) Name() string {
+	return h.name
+}
+
+func (h namedHasher) New() hash.Hash {
+	return h.newHash()
+}
+
+var (
+	MD5    Hasher = namedHasher{"md5", md5.New}
+	SHA256 Hasher = namedHasher{"sha256", sha256.New}
+	BLAKE3 Hasher = namedHasher{"blake3", func() hash.Hash { return blake3.New() }}
+	XXHash Hasher = namedHasher{"xxhash", func() hash.Hash { return xxhash.New() }}
+)
+
+// The algorithm used when none is requested.  This is also the algorithm
+// assumed for hashes stored before algorithms were recorded.
+var Default = MD5
+
+var hashers = map[string]Hasher{
+	MD5.Name():    MD5,
+	SHA256.Name(): SHA256,
+	BLAKE3.Name(): BLAKE3,
+	XXHash.Name(): XXHash,
+}
+
+// Returns the Hasher with the specified name.
+func Lookup(name string) (Hasher, error) {
+	h, ok := hashers[name]
+	if !ok {
+		return nil, errors.New("unknown hash algorithm: " + name)
+	}
+	return h, nil
+}
+
+// Returns the names of all the available algorithms, in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(hashers))
+	for name := range hashers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
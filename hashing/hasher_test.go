@@ -0,0 +1,47 @@
+package hashing
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestKnownDigests(t *testing.T) {
+	expected := map[string]string{
+		"md5":    "c4547432b891a3ed2e6b16e58d42f97b",
+		"sha256": "fed2f36509d93cb8b9e63a8cc65c3743dd59f6b3a6465d5791e7c6f81d4b56bc",
+		"blake3": "02f841aca0f982b087edc3be230368dd5c7a2f5b721db11f87cdd2c3f09f938e",
+		"xxhash": "299cacdef608660f",
+	}
+
+	for name, digest := range expected {
+		h, err := Lookup(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if h.Name() != name {
+			t.Error("wrong name, expected=", name, ", got=", h.Name())
+		}
+
+		w := h.New()
+		w.Write([]byte("constant text string"))
+		got := hex.EncodeToString(w.Sum(nil))
+		if got != digest {
+			t.Error("bad digest for ", name, ", expected=", digest, ", got=", got)
+		}
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	_, err := Lookup("crc32")
+	if err == nil {
+		t.Error("should have failed for unknown algorithm")
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if len(names) != 4 || names[0] != "blake3" || names[3] != "xxhash" {
+		t.Error("wrong names, got ", names)
+	}
+}
@@ -0,0 +1,288 @@
+package keep
+
+import (
+	"errors"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Rule expresses a preference between two files in a group of
+// duplicates, for choosing which one to keep when the others are
+// removed or replaced.
+type Rule interface {
+	// the name used to select the rule, e.g. on the command line
+	Name() string
+	// returns a negative number if a should be kept in preference to b,
+	// a positive number if b should be kept in preference to a, or zero
+	// if the rule has no preference
+	Compare(a, b *filedb.FileEntry) int
+}
+
+// A Protector is a Rule that also marks some files as never to be
+// touched, whether or not they are chosen as the keeper.
+type Protector interface {
+	Rule
+	Protects(entry *filedb.FileEntry) bool
+}
+
+type simpleRule struct {
+	name    string
+	compare func(a, b *filedb.FileEntry) int
+}
+
+func (r simpleRule) Name() string {
+	return r.name
+}
+
+func (r simpleRule) Compare(a, b *filedb.FileEntry) int {
+	return r.compare(a, b)
+}
+
+// A rule that prefers files whose paths match a pattern, using the same
+// syntax as the -exclude and -include patterns.
+type patternRule struct {
+	name    string
+	pattern *filter.Filter
+}
+
+func newPatternRule(name string, glob string, roots []string) (*patternRule, error) {
+	pattern := filter.New()
+	err := pattern.Include(glob)
+	if err != nil {
+		return nil, err
+	}
+	pattern.SetRoots(roots...)
+	return &patternRule{name, pattern}, nil
+}
+
+func (r *patternRule) Name() string {
+	return r.name
+}
+
+func (r *patternRule) Compare(a, b *filedb.FileEntry) int {
+	ma := r.pattern.MatchFile(a.Path)
+	mb := r.pattern.MatchFile(b.Path)
+	switch {
+	case ma && !mb:
+		return -1
+	case mb && !ma:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// A rule that protects files whose paths match a pattern.  Protected
+// files are also preferred as the keeper, since they are kept anyway.
+type neverRule struct {
+	patternRule
+}
+
+func (r *neverRule) Protects(entry *filedb.FileEntry) bool {
+	return r.pattern.MatchFile(entry.Path)
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func numComponents(path string) int64 {
+	return int64(len(strings.Split(strings.Trim(filepath.ToSlash(path), "/"), "/")))
+}
+
+var rules = map[string]Rule{
+	"first": simpleRule{"first", func(a, b *filedb.FileEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	}},
+	"oldest": simpleRule{"oldest", func(a, b *filedb.FileEntry) int {
+		return compareInts(a.LastMod, b.LastMod)
+	}},
+	"newest": simpleRule{"newest", func(a, b *filedb.FileEntry) int {
+		return compareInts(b.LastMod, a.LastMod)
+	}},
+	"shortest": simpleRule{"shortest", func(a, b *filedb.FileEntry) int {
+		return compareInts(int64(len(a.Path)), int64(len(b.Path)))
+	}},
+	"fewest-components": simpleRule{"fewest-components", func(a, b *filedb.FileEntry) int {
+		return compareInts(numComponents(a.Path), numComponents(b.Path))
+	}},
+}
+
+// Rules that take a pattern, written as e.g. "prefer:/archive".  The
+// pattern is matched as by a filter.Filter with the given roots.
+var patternRules = map[string]func(name string, glob string, roots []string) (Rule, error){
+	"prefer": func(name string, glob string, roots []string) (Rule, error) {
+		return newPatternRule(name, glob, roots)
+	},
+	"never": func(name string, glob string, roots []string) (Rule, error) {
+		r, err := newPatternRule(name, glob, roots)
+		if err != nil {
+			return nil, err
+		}
+		return &neverRule{*r}, nil
+	},
+}
+
+// Returns the rule with the specified name.  Patterns in the rule that
+// don't start with "/" are matched beneath the roots, the folders being
+// analyzed, as for filter.Filter.SetRoots().
+func ParseRule(name string, roots ...string) (Rule, error) {
+	if i := strings.Index(name, ":"); i >= 0 {
+		makeRule, ok := patternRules[name[:i]]
+		if !ok {
+			return nil, errors.New("unknown keep rule: " + name)
+		}
+		glob := name[i+1:]
+		if glob == "" {
+			return nil, errors.New("keep rule needs a pattern: " + name)
+		}
+		rule, err := makeRule(name, glob, roots)
+		if err != nil {
+			return nil, errors.New("bad pattern in keep rule " + name + ": " + err.Error())
+		}
+		return rule, nil
+	}
+
+	rule, ok := rules[name]
+	if !ok {
+		return nil, errors.New("unknown keep rule: " + name)
+	}
+	return rule, nil
+}
+
+// Returns the rules with the specified names, in the same order, with
+// their patterns matched beneath the roots.
+func ParseRules(names []string, roots ...string) ([]Rule, error) {
+	result := make([]Rule, 0, len(names))
+	for _, name := range names {
+		rule, err := ParseRule(name, roots...)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+// Returns the names of all the available rules, in sorted order, with
+// the rules that take a pattern written as e.g. "prefer:PATTERN".
+func Names() []string {
+	names := make([]string, 0, len(rules)+len(patternRules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	for name := range patternRules {
+		names = append(names, name+":PATTERN")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The choice of which file to keep from a group of duplicates.
+type Decision struct {
+	// the index of the file to keep
+	Keeper int
+	// the name of the rule that chose the keeper, or "" if no rule
+	// decided and the first path in alphabetical order was kept
+	DecidedBy string
+	// the indexes of the other files that a rule protects, which must
+	// be left alone
+	Protected []int
+}
+
+// Describes how the keeper was chosen.
+func (d Decision) Reason() string {
+	if d.DecidedBy == "" {
+		return "no rule decided, kept the first path"
+	}
+	return "decided by " + d.DecidedBy
+}
+
+// Returns true if the file at the index is protected by a rule.
+func (d Decision) IsProtected(i int) bool {
+	for _, p := range d.Protected {
+		if p == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Chooses the file to keep from a group of duplicates.  The rules are
+// applied in order, each one only deciding between the files that all
+// the earlier rules had no preference between.  If no rule decides,
+// the first path in alphabetical order is kept.
+func Decide(entries []filedb.FileEntry, rules []Rule) Decision {
+	candidates := make([]int, len(entries))
+	for i := range entries {
+		candidates[i] = i
+	}
+
+	decision := Decision{}
+	for _, rule := range rules {
+		if len(candidates) == 1 {
+			break
+		}
+		candidates = best(entries, candidates, rule)
+		if len(candidates) == 1 {
+			decision.DecidedBy = rule.Name()
+		}
+	}
+
+	decision.Keeper = candidates[0]
+	for _, i := range candidates[1:] {
+		if entries[i].Path < entries[decision.Keeper].Path {
+			decision.Keeper = i
+		}
+	}
+
+	for _, rule := range rules {
+		protector, ok := rule.(Protector)
+		if !ok {
+			continue
+		}
+		for i := range entries {
+			if i != decision.Keeper && protector.Protects(&entries[i]) && !decision.IsProtected(i) {
+				decision.Protected = append(decision.Protected, i)
+			}
+		}
+	}
+	sort.Ints(decision.Protected)
+
+	return decision
+}
+
+// Returns the candidates that the rule likes best.
+func best(entries []filedb.FileEntry, candidates []int, rule Rule) []int {
+	var result []int
+	for _, i := range candidates {
+		if len(result) == 0 {
+			result = append(result, i)
+			continue
+		}
+		c := rule.Compare(&entries[i], &entries[result[0]])
+		switch {
+		case c < 0:
+			result = append(result[:0], i)
+		case c == 0:
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Chooses the file to keep from a group of duplicates, returning its
+// index.  See Decide().
+func Choose(entries []filedb.FileEntry, rules []Rule) int {
+	return Decide(entries, rules).Keeper
+}
@@ -0,0 +1,118 @@
+package keep
+
+import (
+	"lostbearlabs.com/ddet/filedb"
+	"testing"
+)
+
+func testEntries() []filedb.FileEntry {
+	return []filedb.FileEntry{
+		*filedb.NewTestFileEntry().SetPath("/b/long/path.txt").SetLastMod(200),
+		*filedb.NewTestFileEntry().SetPath("/c/x.txt").SetLastMod(100),
+		*filedb.NewTestFileEntry().SetPath("/a/path.txt").SetLastMod(300),
+		*filedb.NewTestFileEntry().SetPath("/d/y.txt").SetLastMod(100),
+	}
+}
+
+func TestChooseWithRules(t *testing.T) {
+	cases := []struct {
+		rules    []string
+		expected int
+	}{
+		{nil, 2},
+		{[]string{"first"}, 2},
+		{[]string{"oldest"}, 1},
+		{[]string{"newest"}, 2},
+		{[]string{"shortest"}, 1},
+		{[]string{"shortest", "newest"}, 1},
+		{[]string{"oldest", "shortest"}, 1},
+		{[]string{"prefer:/d"}, 3},
+		{[]string{"prefer:/archive"}, 2},
+		{[]string{"oldest", "prefer:y.txt"}, 3},
+		{[]string{"fewest-components"}, 2},
+		{[]string{"fewest-components", "oldest"}, 1},
+		{[]string{"never:/b"}, 0},
+	}
+
+	for _, c := range cases {
+		rules, err := ParseRules(c.rules)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		chosen := Choose(testEntries(), rules)
+		if chosen != c.expected {
+			t.Error("wrong choice for ", c.rules, ", expected=", c.expected, ", got=", chosen)
+		}
+	}
+}
+
+func TestPatternRulesIgnoreRootNames(t *testing.T) {
+	rules, _ := ParseRules([]string{"prefer:c"})
+	if chosen := Choose(testEntries(), rules); chosen != 1 {
+		t.Error("wrong choice without roots, got ", chosen)
+	}
+
+	// each file is in a root of its own, and "c" only names a root
+	rules, _ = ParseRules([]string{"prefer:c", "never:d"}, "/a", "/b", "/c", "/d")
+	decision := Decide(testEntries(), rules)
+	if decision.Keeper != 2 || len(decision.Protected) != 0 {
+		t.Error("patterns should not match the roots, got ", decision)
+	}
+}
+
+func TestParseUnknownRule(t *testing.T) {
+	_, err := ParseRule("biggest")
+	if err == nil {
+		t.Error("should have failed for unknown rule")
+	}
+}
+
+func TestDecideExplainsChoice(t *testing.T) {
+	cases := []struct {
+		rules     []string
+		keeper    int
+		decidedBy string
+	}{
+		{nil, 2, ""},
+		{[]string{"newest"}, 2, "newest"},
+		{[]string{"oldest"}, 1, ""},
+		{[]string{"oldest", "prefer:/d/**"}, 3, "prefer:/d/**"},
+		{[]string{"shortest", "oldest", "newest"}, 1, ""},
+		{[]string{"first", "oldest"}, 2, "first"},
+	}
+
+	for _, c := range cases {
+		rules, _ := ParseRules(c.rules)
+		decision := Decide(testEntries(), rules)
+		if decision.Keeper != c.keeper || decision.DecidedBy != c.decidedBy {
+			t.Error("wrong decision for ", c.rules, ", expected=", c.keeper, c.decidedBy, ", got=", decision)
+		}
+	}
+}
+
+func TestDecideProtectsFiles(t *testing.T) {
+	rules, _ := ParseRules([]string{"oldest", "never:/a", "never:*.txt"})
+	decision := Decide(testEntries(), rules)
+	if decision.Keeper != 1 {
+		t.Error("wrong keeper, got ", decision.Keeper)
+	}
+	if len(decision.Protected) != 3 || decision.IsProtected(1) || !decision.IsProtected(2) {
+		t.Error("wrong protected files, got ", decision.Protected)
+	}
+
+	rules, _ = ParseRules([]string{"never:/a"})
+	decision = Decide(testEntries(), rules)
+	if decision.Keeper != 2 || len(decision.Protected) != 0 {
+		t.Error("protected file should have been kept, got ", decision)
+	}
+}
+
+func TestParseBadPatternRules(t *testing.T) {
+	for _, name := range []string{"prefer:", "never:[", "like:/a"} {
+		_, err := ParseRule(name)
+		if err == nil {
+			t.Error("should have failed for ", name)
+		}
+	}
+}
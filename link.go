@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"lostbearlabs.com/ddet/action"
+	"lostbearlabs.com/ddet/dset"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"lostbearlabs.com/ddet/keep"
+	"lostbearlabs.com/ddet/verify"
+	"strings"
+)
+
+// The "link" command:  scans a folder, then replaces each group of
+// duplicates with hardlinks to a single copy.
+func runLink(args []string) int {
+	flags := newFlagSet("ddet link", "ddet link <folder> [-v] [options]")
+	sf := addScanFlags(flags)
+	kf := addKeepFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "report what would be linked without changing anything")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	opts, err := sf.options(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	rules, err := kf.rules(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one folder"))
+	}
+
+	path := paths[0]
+	db, err := sf.openFoldersAndDB(path)
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	_, err = scanFiles([]string{path}, db, opts)
+	if err != nil {
+		return commandError(err)
+	}
+
+	format := "Linked %s to %s\n"
+	if *dryRun {
+		format = "Would link %s to %s\n"
+	}
+	totals, err := actOnDuplicates(db, path, opts.Filter, rules, *kf.explain, format, func(identical []filedb.FileEntry, keeper int) *action.Result {
+		return action.Link(db, identical, keeper, *dryRun)
+	})
+	logger.Infof("%d files linked, %d bytes reclaimed, %d files protected, %d files left alone", totals.done, totals.reclaimed, totals.protected, totals.leftAlone)
+	if err != nil {
+		return commandError(err)
+	}
+	return totals.exitCode()
+}
+
+// The flags shared by every command that chooses a file to keep from
+// each group of duplicates.
+type keepFlags struct {
+	names   stringList
+	explain *bool
+}
+
+func addKeepFlags(flags *flag.FlagSet) *keepFlags {
+	kf := &keepFlags{}
+	flags.Var(&kf.names, "keep", "rule for choosing the file to keep, one of: "+strings.Join(keep.Names(), ", ")+" (may be repeated, in priority order)")
+	kf.explain = flags.Bool("explain", false, "show which rule chose the file to keep from each group")
+	return kf
+}
+
+// Returns the keep rules selected by the parsed flags, with their
+// patterns matched beneath the roots.
+func (kf *keepFlags) rules(roots ...string) ([]keep.Rule, error) {
+	return keep.ParseRules(kf.names, roots...)
+}
+
+// Totals over all the groups acted on by actOnDuplicates.
+type actionTotals struct {
+	done      int
+	protected int
+	// files left alone, including those that failed
+	leftAlone int
+	failed    int
+	reclaimed int64
+}
+
+// Returns the exit code for a command that acted on duplicates:  it
+// failed if it couldn't act on some file it meant to.
+func (totals actionTotals) exitCode() int {
+	if totals.failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// Acts on each group of duplicates beneath the path, keeping one file from the group
+// chosen by the rules, along with any files the rules protect.  Groups
+// are verified byte-for-byte first, and only files that really are
+// identical are acted on.  Each file acted on is printed using the
+// format, which is given the file's path and then the keeper's.  Stops
+// with an error if the database can't be read.
+func actOnDuplicates(db *filedb.FileDB, path string, f *filter.Filter, rules []keep.Rule, explain bool, format string, act func(identical []filedb.FileEntry, keeper int) *action.Result) (actionTotals, error) {
+	ks, dupKeys := findDuplicates(db, []string{path}, f)
+
+	var totals actionTotals
+	for _, key := range dupKeys {
+		entries, err := ks.GetFileEntries(db, key)
+		if err != nil {
+			return totals, err
+		}
+		entries = dset.EntriesWithin(entries, path)
+		if len(entries) < 2 {
+			continue
+		}
+		verified := verify.Group(entries)
+		for _, identical := range verified.Identical {
+			decision := keep.Decide(identical, rules)
+			if explain {
+				fmt.Printf("Keeping %s, %s\n", identical[decision.Keeper].Path, decision.Reason())
+			}
+
+			var unprotected []filedb.FileEntry
+			keeper := 0
+			for i, entry := range identical {
+				switch {
+				case i == decision.Keeper:
+					keeper = len(unprotected)
+				case decision.IsProtected(i):
+					fmt.Printf("Leaving %s alone, it is protected\n", entry.Path)
+					continue
+				}
+				unprotected = append(unprotected, entry)
+			}
+			totals.protected += len(decision.Protected)
+			if len(unprotected) < 2 {
+				continue
+			}
+
+			result := act(unprotected, keeper)
+			for _, entry := range result.Done {
+				fmt.Printf(format, entry.Path, result.Keeper.Path)
+			}
+			totals.done += len(result.Done)
+			totals.leftAlone += len(result.Failed)
+			totals.failed += len(result.Failed)
+			totals.reclaimed += result.Reclaimed
+		}
+		totals.leftAlone += len(verified.Different) + len(verified.Changed) + len(verified.Unreadable)
+	}
+	return totals, nil
+}
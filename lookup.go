@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/filedb"
+	"strings"
+)
+
+// The "lookup" command:  reports whether the database knows of files
+// with the same contents as some others, which needn't be in it, or as
+// a hash, without scanning anything.
+func runLookup(args []string) int {
+	flags := newFlagSet("ddet lookup", "ddet lookup <file>... [-v]\n   ddet lookup -hash [ALG:]HEX -size N [-v]")
+	cf := addCommonFlags(flags)
+	hash := flags.String("hash", "", "look up this hash, in hex, optionally preceded by the algorithm and a colon, instead of files")
+	size := flags.Int64("size", -1, "with -hash, the length of the file in bytes")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	setLogging(*cf.verbose)
+	if *hash != "" {
+		if len(paths) > 0 || *size < 0 {
+			return usageError(flags, errors.New("-hash needs -size, and no files"))
+		}
+	} else if len(paths) == 0 {
+		return usageError(flags, errors.New("expected at least one file, or -hash and -size"))
+	}
+
+	db, err := cf.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	if *hash != "" {
+		hashAlg, digest := "", *hash
+		if i := strings.Index(digest, ":"); i >= 0 {
+			hashAlg, digest = digest[:i], digest[i+1:]
+		}
+		result, err := db.LookupHash(hashAlg, digest, *size)
+		if err != nil {
+			return commandError(err)
+		}
+		printLookup(*hash, result)
+		if result.Found() {
+			return exitDuplicates
+		}
+		return exitOK
+	}
+
+	code := exitOK
+	for _, path := range paths {
+		result, err := db.LookupFile(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			code = exitError
+			continue
+		}
+		printLookup(path, result)
+		if result.Found() && code == exitOK {
+			code = exitDuplicates
+		}
+	}
+	return code
+}
+
+// Prints the files found for something looked up, then the files of the
+// same length that may or may not be copies of it.
+func printLookup(name string, result *filedb.LookupResult) {
+	if result.Found() {
+		fmt.Printf("%s: %d copies indexed\n", name, len(result.Matches))
+	} else {
+		fmt.Printf("%s: not indexed\n", name)
+	}
+	for _, e := range result.Matches {
+		fmt.Printf("   %s\n", e.Path)
+	}
+	for _, e := range result.Unknown {
+		fmt.Printf("   %s (same length, changed since it was scanned, so may be a copy)\n", e.Path)
+	}
+}
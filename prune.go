@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/util"
+	"os"
+	"time"
+)
+
+// The "prune" command:  removes the database entries for files beneath a
+// path that no longer exist, without scanning it.  Scanning a folder
+// also does this, but only for the folder scanned.
+func runPrune(args []string) int {
+	flags := newFlagSet("ddet prune", "ddet prune <path> [-older-than DURATION] [-dry-run] [-v]")
+	cf := addCommonFlags(flags)
+	olderThan := flags.Duration("older-than", 0, "also remove entries not seen by a scan in this long, e.g. 720h")
+	dryRun := flags.Bool("dry-run", false, "report what would be removed without changing anything")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	setLogging(*cf.verbose)
+	if *olderThan < 0 {
+		return usageError(flags, errors.New("-older-than must not be negative"))
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one path"))
+	}
+
+	db, err := cf.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	// entries can't be deleted while they are being read, so collect
+	// them first
+	var cutoff int64
+	if *olderThan > 0 {
+		cutoff = time.Now().Add(-*olderThan).Unix()
+	}
+	var stale []string
+	err = db.ProcessAllFileEntries(func(e filedb.FileEntry) {
+		if !util.IsWithin(e.Path, paths[0]) {
+			return
+		}
+		if e.ScanTime < cutoff {
+			stale = append(stale, e.Path)
+			return
+		}
+		if _, err := os.Lstat(e.Path); os.IsNotExist(err) {
+			stale = append(stale, e.Path)
+		}
+	}, paths[0])
+	if err != nil {
+		return commandError(err)
+	}
+
+	verb := "Pruned"
+	if *dryRun {
+		verb = "Would prune"
+	}
+	for _, path := range stale {
+		if !*dryRun {
+			if err := db.DeleteFileEntry(path); err != nil {
+				return commandError(err)
+			}
+		}
+		fmt.Printf("%s %s\n", verb, path)
+	}
+	if *dryRun {
+		logger.Infof("%d entries would be pruned", len(stale))
+	} else {
+		logger.Infof("%d entries pruned", len(stale))
+	}
+	return exitOK
+}
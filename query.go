@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/util"
+	"time"
+)
+
+// The "query" command:  lists the files in the database beneath a path,
+// as of the last scan, without scanning it first.
+func runQuery(args []string) int {
+	flags := newFlagSet("ddet query", "ddet query <path> [-l] [-v] [options]")
+	ff := addFilterFlags(flags)
+	long := flags.Bool("l", false, "also show the length, modification time, and hash of each file")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	f, err := ff.filter(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one path"))
+	}
+
+	db, err := ff.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	count := 0
+	err = db.ProcessAllFileEntries(func(e filedb.FileEntry) {
+		if !util.IsWithin(e.Path, paths[0]) || !f.MatchFile(e.Path) || !f.MatchSize(e.Length) {
+			return
+		}
+		count++
+		if !*long {
+			fmt.Println(e.Path)
+			return
+		}
+		hash := "-"
+		if e.Hash != "" {
+			hash = e.HashAlg + ":" + e.Hash
+		}
+		mtime := time.Unix(e.LastMod, 0).UTC().Format(time.RFC3339)
+		fmt.Printf("%d\t%s\t%s\t%s\n", e.Length, mtime, hash, e.Path)
+	}, paths[0])
+	if err != nil {
+		return commandError(err)
+	}
+	logger.Infof("%d files", count)
+	return exitOK
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// The "report" command:  reports the duplicates beneath one or more paths
+// from what is already in the database, without scanning them first.
+func runReport(args []string) int {
+	flags := newFlagSet("ddet report", "ddet report <path>... [-html FILE] [-format FORMAT] [-o FILE] [-cross-root] [-v] [options]")
+	ff := addFilterFlags(flags)
+	rf := addReportFlags(flags)
+	htmlPath := flags.String("html", "", "write the report as a single HTML page to this file; same as -format html -o FILE")
+	outPath := flags.String("o", "", "file to write the report to (default stdout)")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	f, err := ff.filter(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if *htmlPath != "" {
+		if *outPath != "" {
+			return usageError(flags, errors.New("-html and -o can't be used together"))
+		}
+		*rf.format = "html"
+		*outPath = *htmlPath
+	}
+	ro, err := rf.options(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if err := checkRoots(paths, ro); err != nil {
+		return usageError(flags, err)
+	}
+
+	db, err := ff.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	if *outPath != "" {
+		out, err := os.Create(*outPath)
+		if err != nil {
+			return commandError(err)
+		}
+		defer out.Close()
+		ro.out = out
+	}
+
+	return reportExitCode(analyzeDuplicates(db, paths, f, ro, nil))
+}
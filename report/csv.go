@@ -0,0 +1,63 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// The csv format:  one row per file, with the files in each group
+// sharing a group number.  Unverified files are reported in groups of
+// their own, with their status filled in.  The root column is only
+// filled in when several folders are analyzed together.  Rows are written as each
+// group is found.
+type csvReporter struct {
+	w     *csv.Writer
+	group int
+}
+
+var csvHeader = []string{"group", "hash_alg", "hash", "length", "path", "mtime", "is_keeper", "status", "root"}
+
+func newCSVReporter(w io.Writer, opts Options) Reporter {
+	return &csvReporter{w: csv.NewWriter(w)}
+}
+
+func (r *csvReporter) Begin(roots []string) error {
+	return r.w.Write(csvHeader)
+}
+
+func (r *csvReporter) Group(g Group) error {
+	return r.writeFiles(g.HashAlg, g.Hash, g.Length, g.Files)
+}
+
+func (r *csvReporter) Unverified(u Unverified) error {
+	return r.writeFiles(u.HashAlg, u.Hash, u.Length, u.Files)
+}
+
+func (r *csvReporter) End(summary Summary) error {
+	r.w.Flush()
+	return r.w.Error()
+}
+
+func (r *csvReporter) writeFiles(hashAlg string, hash string, length int64, files []File) error {
+	r.group++
+	for _, file := range files {
+		err := r.w.Write([]string{
+			strconv.Itoa(r.group),
+			hashAlg,
+			hash,
+			strconv.FormatInt(length, 10),
+			file.Path,
+			file.LastMod.Format(time.RFC3339),
+			strconv.FormatBool(file.Keep),
+			file.Status,
+			file.Root,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
@@ -0,0 +1,100 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"lostbearlabs.com/ddet/filedb"
+	"strings"
+	"testing"
+)
+
+func TestCSVReport(t *testing.T) {
+	out := writeTestReport(t, "csv")
+
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal("bad csv: ", err, out)
+	}
+	if len(records) != 5 || strings.Join(records[0], ",") != "group,hash_alg,hash,length,path,mtime,is_keeper,status,root" {
+		t.Fatal("bad csv, got ", records)
+	}
+	expected := []string{"1", "md5", "8d9ace9df01c0c0876a95c3f810e7e9a", "128", "/b", "1970-01-01T00:01:40Z", "true", "", ""}
+	if strings.Join(records[2], ",") != strings.Join(expected, ",") {
+		t.Error("bad row, expected=", expected, ", got=", records[2])
+	}
+	if records[4][0] != "2" || records[4][4] != "/d" || records[4][7] != "different" {
+		t.Error("bad unverified row, got ", records[4])
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	items := []*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/a/foo1.txt").SetInode(7),
+		filedb.NewTestFileEntry().SetPath("/a/foo, \"2\".txt"),
+		filedb.NewTestFileEntry().SetPath("/b/foo3.txt"),
+	}
+	db.StoreFileEntries(items)
+
+	var buf bytes.Buffer
+	count, err := ExportCSV(db, "/a", &buf)
+	if err != nil || count != 2 {
+		t.Fatal("bad export, got ", count, err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(records) != 3 {
+		t.Fatal("bad csv, got ", records, err)
+	}
+	if strings.Join(records[0], ",") != "Path,Length,LastMod,Device,Inode,HashAlg,Hash,PartialHash,ScanTime" {
+		t.Error("bad header, got ", records[0])
+	}
+	if records[1][0] != "/a/foo, \"2\".txt" || records[2][0] != "/a/foo1.txt" || records[2][4] != "7" {
+		t.Error("bad rows, got ", records)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	src, _ := filedb.NewTempDB()
+	defer src.Close()
+	items := []*filedb.FileEntry{
+		filedb.NewTestFileEntry().SetPath("/a/foo1.txt").SetInode(7).SetLastMod(300),
+		filedb.NewTestFileEntry().SetPath("/a/foo, \"2\".txt").SetPartialHash(""),
+	}
+	src.StoreFileEntries(items)
+	var buf bytes.Buffer
+	ExportCSV(src, "/", &buf)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+	count, err := ImportCSV(db, &buf)
+	if err != nil || count != 2 {
+		t.Fatal("bad import, got ", count, err)
+	}
+	for _, item := range items {
+		got := db.ReadFileEntry(item.Path)
+		if got == nil || *got != *item {
+			t.Error("bad entry, expected=", item, ", got=", got)
+		}
+	}
+}
+
+func TestImportBadCSV(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	for _, text := range []string{
+		"",
+		"Path,Length,LastMod,Device,Inode,HashAlg,Hash,PartialHash\n",
+		"Path,Size,LastMod,Device,Inode,HashAlg,Hash,PartialHash,ScanTime\n",
+		"Path,Length,LastMod,Device,Inode,HashAlg,Hash,PartialHash,ScanTime\n/a,x,0,0,0,md5,,,0\n",
+		"Path,Length,LastMod,Device,Inode,HashAlg,Hash,PartialHash,ScanTime\n,1,0,0,0,md5,,,0\n",
+	} {
+		_, err := ImportCSV(db, strings.NewReader(text))
+		if err == nil {
+			t.Error("should have failed to import ", text)
+		}
+	}
+}
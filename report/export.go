@@ -0,0 +1,123 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"lostbearlabs.com/ddet/filedb"
+	"strconv"
+)
+
+// The columns written by ExportCSV, named after those in the FileDB.
+var exportHeader = []string{"Path", "Length", "LastMod", "Device", "Inode", "HashAlg", "Hash", "PartialHash", "ScanTime"}
+
+// Writes every FileDB entry beneath the path prefix as CSV, one row per
+// entry, in path order.  Entries are streamed from the database rather
+// than read into memory, so any number of them can be exported.
+// Returns the number of entries written.
+func ExportCSV(db *filedb.FileDB, path string, w io.Writer) (int, error) {
+	out := csv.NewWriter(w)
+	out.Write(exportHeader)
+
+	count := 0
+	writeFn := func(e filedb.FileEntry) {
+		out.Write([]string{
+			e.Path,
+			strconv.FormatInt(e.Length, 10),
+			strconv.FormatInt(e.LastMod, 10),
+			strconv.FormatInt(e.Device, 10),
+			strconv.FormatInt(e.Inode, 10),
+			e.HashAlg,
+			e.Hash,
+			e.PartialHash,
+			strconv.FormatInt(e.ScanTime, 10),
+		})
+		count++
+	}
+	err := db.ProcessAllFileEntries(writeFn, path)
+	if err != nil {
+		return count, err
+	}
+
+	out.Flush()
+	return count, out.Error()
+}
+
+// The number of entries ImportCSV stores in each transaction.
+const importBatchSize = 10000
+
+// Reads entries written by ExportCSV and stores them in the FileDB,
+// replacing any existing entries for the same paths.  Returns the
+// number of entries stored.
+func ImportCSV(db *filedb.FileDB, r io.Reader) (int, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = len(exportHeader)
+	in.ReuseRecord = true
+
+	header, err := in.Read()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read header: %v", err)
+	}
+	for i, name := range exportHeader {
+		if header[i] != name {
+			return 0, fmt.Errorf("bad header: expected column %d to be %s, got %s", i+1, name, header[i])
+		}
+	}
+
+	count := 0
+	batch := make([]*filedb.FileEntry, 0, importBatchSize)
+	flush := func() error {
+		if err := db.StoreFileEntries(batch); err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		entry, err := parseExportRecord(record)
+		if err != nil {
+			line, _ := in.FieldPos(0)
+			return count, fmt.Errorf("line %d: %v", line, err)
+		}
+		batch = append(batch, entry)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
+
+func parseExportRecord(record []string) (*filedb.FileEntry, error) {
+	if record[0] == "" {
+		return nil, fmt.Errorf("empty %s", exportHeader[0])
+	}
+	// Length, LastMod, Device, Inode, and ScanTime
+	var numbers []int64
+	for _, column := range []int{1, 2, 3, 4, 8} {
+		n, err := strconv.ParseInt(record[column], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s: %s", exportHeader[column], record[column])
+		}
+		numbers = append(numbers, n)
+	}
+	return filedb.NewBlankFileEntry().
+		SetPath(record[0]).
+		SetLength(numbers[0]).
+		SetLastMod(numbers[1]).
+		SetDevice(numbers[2]).
+		SetInode(numbers[3]).
+		SetHashAlg(record[5]).
+		SetHash(record[6]).
+		SetPartialHash(record[7]).
+		SetScanTime(numbers[4]), nil
+}
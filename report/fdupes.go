@@ -0,0 +1,80 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Output compatible with fdupes (and jdupes):  the files in each group
+// one per line, with a blank line after each group.  The file to keep
+// is listed first, so that tools which treat the first file of a group
+// as the original (like fdupes -f) agree with the keep rules.  With
+// SameLine, each group is instead written on one line with its files
+// separated by spaces, and with spaces and backslashes in file names
+// escaped by backslashes.  With ShowSize, each group is preceded by a
+// line giving the size of its files.  Unverified files are not
+// reported, since they are not known to be duplicates.
+type fdupesReporter struct {
+	w    io.Writer
+	opts Options
+}
+
+func newFdupesReporter(w io.Writer, opts Options) Reporter {
+	return &fdupesReporter{w: w, opts: opts}
+}
+
+func (r *fdupesReporter) Begin(roots []string) error {
+	return nil
+}
+
+var fdupesEscaper = strings.NewReplacer(`\`, `\\`, ` `, `\ `)
+
+func (r *fdupesReporter) Group(g Group) error {
+	var b strings.Builder
+	if r.opts.ShowSize {
+		plural := "s"
+		if g.Length == 1 {
+			plural = ""
+		}
+		fmt.Fprintf(&b, "%d byte%s each:\n", g.Length, plural)
+	}
+	for i, file := range keeperFirst(g.Files) {
+		if r.opts.SameLine {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(fdupesEscaper.Replace(file.Path))
+		} else {
+			b.WriteString(file.Path + "\n")
+		}
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func (r *fdupesReporter) Unverified(u Unverified) error {
+	return nil
+}
+
+func (r *fdupesReporter) End(summary Summary) error {
+	return nil
+}
+
+// Returns the files with the one to keep moved to the front, and the
+// others in their original order.
+func keeperFirst(files []File) []File {
+	result := make([]File, 0, len(files))
+	for _, file := range files {
+		if file.Keep {
+			result = append(result, file)
+		}
+	}
+	for _, file := range files {
+		if !file.Keep {
+			result = append(result, file)
+		}
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+)
+
+func writeFdupesReport(opts Options, groups ...Group) string {
+	var buf bytes.Buffer
+	r, _ := New("fdupes", &buf, opts)
+	r.Begin([]string{"/"})
+	for _, g := range groups {
+		r.Group(g)
+	}
+	r.Unverified(Unverified{Files: []File{{Path: "/d"}}})
+	r.End(Summary{})
+	return buf.String()
+}
+
+func TestFdupesReport(t *testing.T) {
+	out := writeFdupesReport(Options{}, testGroup(), testGroup())
+	expected := "/b\n/a\n/c\n\n/b\n/a\n/c\n\n"
+	if out != expected {
+		t.Errorf("bad report, expected=%q, got=%q", expected, out)
+	}
+}
+
+func TestFdupesReportWithOptions(t *testing.T) {
+	g := testGroup()
+	g.Files[0].Path = `/a b\c`
+	out := writeFdupesReport(Options{ShowSize: true, SameLine: true}, g)
+	expected := "128 bytes each:\n/b /a\\ b\\\\c /c\n"
+	if out != expected {
+		t.Errorf("bad report, expected=%q, got=%q", expected, out)
+	}
+
+	g.Length = 1
+	out = writeFdupesReport(Options{ShowSize: true}, g)
+	expected = "1 byte each:\n/b\n/a b\\c\n/c\n\n"
+	if out != expected {
+		t.Errorf("bad report, expected=%q, got=%q", expected, out)
+	}
+}
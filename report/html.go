@@ -0,0 +1,332 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A single static HTML page, meant for people who don't use the command
+// line:  charts of the reclaimable space by directory, by file extension,
+// and by file size, then a table of the groups that can be sorted and
+// filtered.  Everything is embedded in the page, so it can be emailed or
+// opened from a file share without any other assets.  The page is
+// written once the analysis is complete.
+type htmlReporter struct {
+	w   io.Writer
+	doc htmlDocument
+}
+
+type htmlDocument struct {
+	Root       string
+	Generated  time.Time
+	Summary    Summary
+	Groups     []Group
+	Unverified []Unverified
+	Charts     []htmlChart
+}
+
+type htmlChart struct {
+	Title string
+	Bars  []chartBar
+}
+
+// One bar of a chart:  the bytes reclaimable from some kind of file, and
+// that as a percentage of the total.
+type chartBar struct {
+	Label   string
+	Bytes   int64
+	Percent float64
+}
+
+// The number of bars in the directory and extension charts; the rest are
+// lumped together into a final "other" bar.
+const maxChartBars = 10
+
+// The size buckets charted, each holding the files smaller than its limit
+// and at least as large as the previous one's.
+var sizeBuckets = []struct {
+	label string
+	limit int64
+}{
+	{"under 1 KB", 1 << 10},
+	{"1 KB to 1 MB", 1 << 20},
+	{"1 MB to 100 MB", 100 << 20},
+	{"100 MB to 1 GB", 1 << 30},
+	{"1 GB and over", -1},
+}
+
+func newHTMLReporter(w io.Writer, opts Options) Reporter {
+	return &htmlReporter{w: w}
+}
+
+func (r *htmlReporter) Begin(roots []string) error {
+	r.doc = htmlDocument{Root: strings.Join(roots, ", "), Generated: time.Now()}
+	return nil
+}
+
+func (r *htmlReporter) Group(g Group) error {
+	r.doc.Groups = append(r.doc.Groups, g)
+	return nil
+}
+
+func (r *htmlReporter) Unverified(u Unverified) error {
+	r.doc.Unverified = append(r.doc.Unverified, u)
+	return nil
+}
+
+func (r *htmlReporter) End(summary Summary) error {
+	r.doc.Summary = summary
+
+	byDir := make(map[string]int64)
+	byExt := make(map[string]int64)
+	bySize := make(map[string]int64)
+	for _, g := range r.doc.Groups {
+		for _, file := range reclaimableCopies(g) {
+			byDir[filepath.Dir(file.Path)] += g.Length
+			ext := strings.ToLower(filepath.Ext(file.Path))
+			if ext == "" {
+				ext = "(none)"
+			}
+			byExt[ext] += g.Length
+			bySize[sizeBucket(g.Length)] += g.Length
+		}
+	}
+	var sizes []chartBar
+	for _, bucket := range sizeBuckets {
+		sizes = append(sizes, newChartBar(bucket.label, bySize[bucket.label], summary.Reclaimable))
+	}
+	r.doc.Charts = []htmlChart{
+		{"By directory", chart(byDir, summary.Reclaimable)},
+		{"By file extension", chart(byExt, summary.Reclaimable)},
+		{"By file size", sizes},
+	}
+
+	return htmlTemplate.Execute(r.w, &r.doc)
+}
+
+// Returns the files in a group whose space would be freed by reducing it
+// to a single copy:  one file for each copy other than the keeper's, with
+// hardlinks to the same copy counted once.
+func reclaimableCopies(g Group) []File {
+	kept := ""
+	for _, file := range g.Files {
+		if file.Keep {
+			kept = file.Path
+			if file.HardlinkOf != "" {
+				kept = file.HardlinkOf
+			}
+		}
+	}
+
+	var result []File
+	for _, file := range g.Files {
+		if file.HardlinkOf != "" {
+			continue
+		}
+		if kept == "" {
+			// no keeper was chosen; keep the first copy
+			kept = file.Path
+			continue
+		}
+		if file.Path != kept {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+func sizeBucket(length int64) string {
+	for _, bucket := range sizeBuckets {
+		if bucket.limit < 0 || length < bucket.limit {
+			return bucket.label
+		}
+	}
+	return ""
+}
+
+func newChartBar(label string, bytes int64, total int64) chartBar {
+	bar := chartBar{Label: label, Bytes: bytes}
+	if total > 0 {
+		bar.Percent = 100 * float64(bytes) / float64(total)
+	}
+	return bar
+}
+
+// Returns the bars for a chart, largest first, with everything past the
+// first few lumped together.
+func chart(bytes map[string]int64, total int64) []chartBar {
+	bars := make([]chartBar, 0, len(bytes))
+	for label, n := range bytes {
+		bars = append(bars, newChartBar(label, n, total))
+	}
+	sort.Slice(bars, func(i, j int) bool {
+		if bars[i].Bytes != bars[j].Bytes {
+			return bars[i].Bytes > bars[j].Bytes
+		}
+		return bars[i].Label < bars[j].Label
+	})
+	if len(bars) <= maxChartBars {
+		return bars
+	}
+	var other int64
+	for _, bar := range bars[maxChartBars:] {
+		other += bar.Bytes
+	}
+	return append(bars[:maxChartBars], newChartBar("other", other, total))
+}
+
+// Formats a number of bytes for people, e.g. "1.5 MB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+var htmlTemplate = template.Must(template.New("html").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"add":   func(a, b int) int { return a + b },
+	"upper": strings.ToUpper,
+}).Parse(htmlPage))
+
+const htmlPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Duplicate files in {{.Root}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+.summary td { padding: 0.2em 1em 0.2em 0; }
+.charts { display: flex; flex-wrap: wrap; gap: 2em; }
+.chart { flex: 1 1 20em; }
+.bar { display: flex; align-items: center; margin: 0.3em 0; font-size: 0.9em; }
+.bar .label { width: 12em; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.bar .track { flex: 1; background: #eee; height: 1em; margin: 0 0.5em; }
+.bar .fill { background: #4a7ebb; height: 100%; }
+.bar .value { width: 6em; text-align: right; }
+table.groups { border-collapse: collapse; width: 100%; }
+table.groups th, table.groups td { border-bottom: 1px solid #ddd; padding: 0.3em 0.5em; text-align: left; vertical-align: top; }
+table.groups th { cursor: pointer; background: #f4f4f4; }
+table.groups td.num { text-align: right; white-space: nowrap; }
+.keep { font-weight: bold; }
+.note { color: #777; }
+#filter { width: 30em; padding: 0.3em; margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>Duplicate files in {{.Root}}</h1>
+<p>Generated by ddet on {{.Generated.Format "2006-01-02 15:04:05"}}</p>
+
+<table class="summary">
+<tr><td>Files considered</td><td>{{.Summary.Files}}</td></tr>
+<tr><td>Groups of duplicates</td><td>{{.Summary.Groups}}</td></tr>
+<tr><td>Duplicate files</td><td>{{.Summary.DuplicateFiles}}</td></tr>
+<tr><td>Space reclaimable</td><td>{{bytes .Summary.Reclaimable}}</td></tr>
+{{- if .Summary.Verified}}
+<tr><td>Files that could not be verified</td><td>{{.Summary.UnverifiedFiles}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Space reclaimable</h2>
+<div class="charts">
+{{- range .Charts}}
+<div class="chart">
+<h3>{{.Title}}</h3>
+{{- range .Bars}}
+<div class="bar"><span class="label" title="{{.Label}}">{{.Label}}</span><span class="track"><span class="fill" style="display: block; width: {{printf "%.1f" .Percent}}%"></span></span><span class="value">{{bytes .Bytes}}</span></div>
+{{- else}}
+<p class="note">Nothing to reclaim.</p>
+{{- end}}
+</div>
+{{- end}}
+</div>
+
+<h2>Groups of duplicates</h2>
+<input id="filter" type="search" placeholder="Show only groups with a path containing...">
+<table class="groups" id="groups">
+<thead>
+<tr><th data-type="num">#</th><th data-type="num">Files</th><th data-type="num">Size</th><th data-type="num">Reclaimable</th><th data-type="text">Paths</th></tr>
+</thead>
+<tbody>
+{{- range $i, $g := .Groups}}
+<tr>
+<td class="num" data-value="{{add $i 1}}">{{add $i 1}}</td>
+<td class="num" data-value="{{len $g.Files}}">{{len $g.Files}}</td>
+<td class="num" data-value="{{$g.Length}}">{{bytes $g.Length}}</td>
+<td class="num" data-value="{{$g.Reclaimable}}">{{bytes $g.Reclaimable}}</td>
+<td data-value="{{(index $g.Files 0).Path}}">
+<details>
+<summary>{{(index $g.Files 0).Path}}{{if gt (len $g.Files) 1}} <span class="note">and {{add (len $g.Files) -1}} more</span>{{end}}</summary>
+<ul>
+{{- range $g.Files}}
+<li{{if .Keep}} class="keep"{{end}}>{{.Path}}
+{{- if .Keep}} <span class="note">(keep)</span>{{else if .Protected}} <span class="note">(protected)</span>{{end}}
+{{- if .HardlinkOf}} <span class="note">(hardlink of {{.HardlinkOf}})</span>{{end}}
+{{- if .Root}} <span class="note">(in {{.Root}})</span>{{end}}</li>
+{{- end}}
+</ul>
+<p class="note">{{upper $g.HashAlg}} {{$g.Hash}}{{if $g.Verified}}, verified identical{{end}}; keep: {{$g.KeepReason}}</p>
+</details>
+</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+{{- if .Unverified}}
+
+<h2>Files that could not be verified</h2>
+<ul>
+{{- range .Unverified}}
+{{- range .Files}}
+<li>{{.Path}} <span class="note">({{.Status}})</span></li>
+{{- end}}
+{{- end}}
+</ul>
+{{- end}}
+
+<script>
+(function() {
+	var table = document.getElementById("groups");
+	var body = table.tBodies[0];
+	var headers = table.tHead.rows[0].cells;
+	for (var i = 0; i < headers.length; i++) {
+		headers[i].addEventListener("click", sortBy.bind(null, i));
+	}
+	var ascending = {};
+	function sortBy(column) {
+		var numeric = headers[column].getAttribute("data-type") === "num";
+		var up = ascending[column] = !ascending[column];
+		var rows = Array.prototype.slice.call(body.rows);
+		rows.sort(function(a, b) {
+			var x = a.cells[column].getAttribute("data-value");
+			var y = b.cells[column].getAttribute("data-value");
+			var c = numeric ? Number(x) - Number(y) : x.localeCompare(y);
+			return up ? c : -c;
+		});
+		rows.forEach(function(row) { body.appendChild(row); });
+	}
+	document.getElementById("filter").addEventListener("input", function() {
+		var text = this.value.toLowerCase();
+		Array.prototype.forEach.call(body.rows, function(row) {
+			var paths = row.cells[4].textContent.toLowerCase();
+			row.style.display = paths.indexOf(text) >= 0 ? "" : "none";
+		});
+	});
+})();
+</script>
+</body>
+</html>
+`
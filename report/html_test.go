@@ -0,0 +1,72 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLReport(t *testing.T) {
+	out := writeTestReport(t, "html")
+
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") || !strings.HasSuffix(out, "</html>\n") {
+		t.Error("not a complete page, got ", out)
+	}
+	for _, want := range []string{
+		"Duplicate files in /root",
+		`<li class="keep">/b <span class="note">(keep)</span>`,
+		`/c <span class="note">(protected)</span> <span class="note">(hardlink of /a)</span>`,
+		`<li>/d <span class="note">(different)</span></li>`,
+		"<td>Space reclaimable</td><td>128 B</td>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Error("missing ", want, " in ", out)
+		}
+	}
+	if strings.Contains(out, "<link") || strings.Contains(out, "src=") {
+		t.Error("page should not load any other assets")
+	}
+}
+
+func TestHTMLReportEscapesPaths(t *testing.T) {
+	var b strings.Builder
+	r, _ := New("html", &b, Options{})
+	r.Begin([]string{"/<root>"})
+	g := testGroup()
+	g.Files[0].Path = "/<script>"
+	r.Group(g)
+	r.End(Summary{})
+
+	if strings.Contains(b.String(), "/<script>") || strings.Contains(b.String(), "/<root>") {
+		t.Error("paths not escaped, got ", b.String())
+	}
+}
+
+func TestReclaimableCopies(t *testing.T) {
+	// /a and /c are the same file, and /b is kept
+	copies := reclaimableCopies(testGroup())
+	if len(copies) != 1 || copies[0].Path != "/a" {
+		t.Error("bad copies, got ", copies)
+	}
+}
+
+func TestChart(t *testing.T) {
+	bytes := map[string]int64{}
+	for i := 0; i < maxChartBars+2; i++ {
+		bytes[string(rune('a'+i))] = int64(i + 1)
+	}
+	bars := chart(bytes, 100)
+	if len(bars) != maxChartBars+1 || bars[0].Label != "l" || bars[0].Percent != 12 {
+		t.Error("bad bars, got ", bars)
+	}
+	if last := bars[maxChartBars]; last.Label != "other" || last.Bytes != 3 {
+		t.Error("bad other bar, got ", last)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KB", 5 << 30: "5.0 GB"} {
+		if got := formatBytes(n); got != want {
+			t.Error("formatBytes(", n, ") got ", got, " want ", want)
+		}
+	}
+}
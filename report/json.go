@@ -0,0 +1,108 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// The json format:  a single document, written once the analysis is
+// complete.
+type jsonReporter struct {
+	w   io.Writer
+	doc jsonDocument
+}
+
+type jsonDocument struct {
+	Version int `json:"version"`
+	// the first folder analyzed, and all of them
+	Root       string       `json:"root"`
+	Roots      []string     `json:"roots"`
+	Generated  time.Time    `json:"generated"`
+	Summary    Summary      `json:"summary"`
+	Groups     []Group      `json:"groups"`
+	Unverified []Unverified `json:"unverified"`
+}
+
+func newJSONReporter(w io.Writer, opts Options) Reporter {
+	return &jsonReporter{w: w}
+}
+
+func (r *jsonReporter) Begin(roots []string) error {
+	r.doc = jsonDocument{
+		Version:    SchemaVersion,
+		Root:       roots[0],
+		Roots:      roots,
+		Generated:  time.Now().UTC(),
+		Groups:     []Group{},
+		Unverified: []Unverified{},
+	}
+	return nil
+}
+
+func (r *jsonReporter) Group(g Group) error {
+	r.doc.Groups = append(r.doc.Groups, g)
+	return nil
+}
+
+func (r *jsonReporter) Unverified(u Unverified) error {
+	r.doc.Unverified = append(r.doc.Unverified, u)
+	return nil
+}
+
+func (r *jsonReporter) End(summary Summary) error {
+	r.doc.Summary = summary
+	enc := json.NewEncoder(r.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.doc)
+}
+
+// The ndjson format:  one JSON object per line, each with a "type" of
+// header, group, unverified, or summary.  Groups are written as they are
+// found, between a single header and a single summary.
+type ndjsonReporter struct {
+	enc *json.Encoder
+}
+
+type ndjsonHeader struct {
+	Type      string    `json:"type"`
+	Version   int       `json:"version"`
+	Root      string    `json:"root"`
+	Roots     []string  `json:"roots"`
+	Generated time.Time `json:"generated"`
+}
+
+type ndjsonGroup struct {
+	Type string `json:"type"`
+	Group
+}
+
+type ndjsonUnverified struct {
+	Type string `json:"type"`
+	Unverified
+}
+
+type ndjsonSummary struct {
+	Type string `json:"type"`
+	Summary
+}
+
+func newNDJSONReporter(w io.Writer, opts Options) Reporter {
+	return &ndjsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *ndjsonReporter) Begin(roots []string) error {
+	return r.enc.Encode(ndjsonHeader{"header", SchemaVersion, roots[0], roots, time.Now().UTC()})
+}
+
+func (r *ndjsonReporter) Group(g Group) error {
+	return r.enc.Encode(ndjsonGroup{"group", g})
+}
+
+func (r *ndjsonReporter) Unverified(u Unverified) error {
+	return r.enc.Encode(ndjsonUnverified{"unverified", u})
+}
+
+func (r *ndjsonReporter) End(summary Summary) error {
+	return r.enc.Encode(ndjsonSummary{"summary", summary})
+}
@@ -0,0 +1,96 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func writeTestReport(t *testing.T, format string) string {
+	var buf bytes.Buffer
+	r, err := New(format, &buf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := Summary{Verified: true}
+	r.Begin([]string{"/root"})
+	g := testGroup()
+	summary.AddGroup(g)
+	r.Group(g)
+	u := Unverified{HashAlg: "md5", Hash: "abc", Length: 5, Files: []File{{Path: "/d", Status: "different"}}}
+	summary.AddUnverified(u)
+	r.Unverified(u)
+	r.End(summary)
+	return buf.String()
+}
+
+func TestJSONReport(t *testing.T) {
+	out := writeTestReport(t, "json")
+
+	var doc struct {
+		Version    int
+		Root       string
+		Roots      []string
+		Summary    Summary
+		Groups     []Group
+		Unverified []Unverified
+	}
+	err := json.Unmarshal([]byte(out), &doc)
+	if err != nil {
+		t.Fatal("bad json: ", err, out)
+	}
+	if doc.Version != SchemaVersion || doc.Root != "/root" || len(doc.Roots) != 1 {
+		t.Error("bad header, got ", doc)
+	}
+	if doc.Summary.Groups != 1 || doc.Summary.UnverifiedFiles != 1 || doc.Summary.Reclaimable != 128 {
+		t.Error("bad summary, got ", doc.Summary)
+	}
+	if len(doc.Groups) != 1 || len(doc.Groups[0].Files) != 3 || !doc.Groups[0].Files[1].Keep {
+		t.Error("bad groups, got ", doc.Groups)
+	}
+	if len(doc.Unverified) != 1 || doc.Unverified[0].Files[0].Status != "different" {
+		t.Error("bad unverified files, got ", doc.Unverified)
+	}
+}
+
+func TestJSONReportWithNoGroups(t *testing.T) {
+	var buf bytes.Buffer
+	r, _ := New("json", &buf, Options{})
+	r.Begin([]string{"/root"})
+	r.End(Summary{})
+	if !strings.Contains(buf.String(), `"groups": []`) {
+		t.Error("groups should be an empty list, got ", buf.String())
+	}
+}
+
+func TestNDJSONReport(t *testing.T) {
+	out := writeTestReport(t, "ndjson")
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	expected := []string{"header", "group", "unverified", "summary"}
+	if len(lines) != len(expected) {
+		t.Fatal("wrong number of lines, got ", out)
+	}
+	for i, line := range lines {
+		var record map[string]interface{}
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			t.Fatal("bad json: ", err, line)
+		}
+		if record["type"] != expected[i] {
+			t.Error("wrong type, expected=", expected[i], ", got=", record["type"])
+		}
+	}
+
+	var group struct {
+		Group
+	}
+	json.Unmarshal([]byte(lines[1]), &group)
+	if group.Hash != testGroup().Hash || len(group.Files) != 3 {
+		t.Error("bad group, got ", group)
+	}
+	if !strings.Contains(lines[0], `"version":1`) {
+		t.Error("header should have the schema version, got ", lines[0])
+	}
+}
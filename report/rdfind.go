@@ -0,0 +1,80 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Output compatible with the results.txt written by rdfind.  The file
+// to keep is reported as the first occurrence in each group, and the
+// others as duplicates of it, with the negated id of the first
+// occurrence.  As in rdfind, each file's priority is the position of its
+// root among the folders analyzed, starting from 1, and a duplicate in a
+// different root from the first occurrence is DUPTYPE_OUTSIDE_TREE.
+// Unverified files are not reported.
+type rdfindReporter struct {
+	w     io.Writer
+	roots []string
+	group int
+}
+
+func newRdfindReporter(w io.Writer, opts Options) Reporter {
+	return &rdfindReporter{w: w}
+}
+
+func (r *rdfindReporter) Begin(roots []string) error {
+	r.roots = roots
+	_, err := io.WriteString(r.w, "# Automatically generated\n# duptype id depth size device inode priority name\n")
+	return err
+}
+
+func (r *rdfindReporter) Group(g Group) error {
+	r.group++
+	var b strings.Builder
+	files := keeperFirst(g.Files)
+	for i, file := range files {
+		duptype := "DUPTYPE_WITHIN_SAME_TREE"
+		id := -r.group
+		if i == 0 {
+			duptype = "DUPTYPE_FIRST_OCCURRENCE"
+			id = r.group
+		} else if file.Root != files[0].Root {
+			duptype = "DUPTYPE_OUTSIDE_TREE"
+		}
+		root, priority := r.rootOf(file)
+		fmt.Fprintf(&b, "%s %d %d %d %d %d %d %s\n", duptype, id, depth(root, file.Path), g.Length, file.Device, file.Inode, priority, file.Path)
+	}
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func (r *rdfindReporter) Unverified(u Unverified) error {
+	return nil
+}
+
+func (r *rdfindReporter) End(summary Summary) error {
+	_, err := io.WriteString(r.w, "# end of file\n")
+	return err
+}
+
+// Returns the root of the file and its priority.  A file is given the
+// first root unless it is annotated with another.
+func (r *rdfindReporter) rootOf(file File) (string, int) {
+	for i, root := range r.roots {
+		if root == file.Root {
+			return root, i + 1
+		}
+	}
+	return r.roots[0], 1
+}
+
+// Returns the number of folders between the root and the file.
+func depth(root string, path string) int {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return 0
+	}
+	return len(strings.Split(filepath.ToSlash(rel), "/"))
+}
@@ -0,0 +1,54 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRdfindReport(t *testing.T) {
+	var buf bytes.Buffer
+	r, _ := New("rdfind", &buf, Options{})
+	r.Begin([]string{"/"})
+	r.Group(testGroup())
+	g := testGroup()
+	g.Files[0].Path = "/x/y/a"
+	r.Group(g)
+	r.End(Summary{})
+
+	expected := `# Automatically generated
+# duptype id depth size device inode priority name
+DUPTYPE_FIRST_OCCURRENCE 1 0 128 1 11 1 /b
+DUPTYPE_WITHIN_SAME_TREE -1 0 128 1 10 1 /a
+DUPTYPE_WITHIN_SAME_TREE -1 0 128 1 10 1 /c
+DUPTYPE_FIRST_OCCURRENCE 2 0 128 1 11 1 /b
+DUPTYPE_WITHIN_SAME_TREE -2 2 128 1 10 1 /x/y/a
+DUPTYPE_WITHIN_SAME_TREE -2 0 128 1 10 1 /c
+# end of file
+`
+	if buf.String() != expected {
+		t.Error("bad report, expected:\n", expected, "got:\n", buf.String())
+	}
+}
+
+func TestRdfindReportWithRoots(t *testing.T) {
+	var buf bytes.Buffer
+	r, _ := New("rdfind", &buf, Options{})
+	r.Begin([]string{"/data", "/backup"})
+	r.Group(Group{Length: 5, Files: []File{
+		{Path: "/backup/x/a", Root: "/backup"},
+		{Path: "/data/a", Keep: true, Root: "/data"},
+		{Path: "/data/b", Root: "/data"},
+	}})
+	r.End(Summary{})
+
+	expected := `# Automatically generated
+# duptype id depth size device inode priority name
+DUPTYPE_FIRST_OCCURRENCE 1 0 5 0 0 1 /data/a
+DUPTYPE_OUTSIDE_TREE -1 1 5 0 0 2 /backup/x/a
+DUPTYPE_WITHIN_SAME_TREE -1 0 5 0 0 1 /data/b
+# end of file
+`
+	if buf.String() != expected {
+		t.Error("bad report, expected:\n", expected, "got:\n", buf.String())
+	}
+}
@@ -0,0 +1,205 @@
+package report
+
+import (
+	"errors"
+	"github.com/juju/loggo"
+	"io"
+	"lostbearlabs.com/ddet/dset"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/keep"
+	"lostbearlabs.com/ddet/verify"
+	"sort"
+	"time"
+)
+
+var logger = loggo.GetLogger("report")
+
+// The version of the schema followed by the json and ndjson formats.  It
+// is incremented whenever a field is removed or its meaning changes;
+// fields may be added without changing it.
+const SchemaVersion = 1
+
+// A Reporter writes the results of an analysis in some format.  Its
+// methods are called in order:  Begin() once, with the folders analyzed,
+// then Group() and Unverified() for each group as it is found, then End()
+// once.
+type Reporter interface {
+	Begin(roots []string) error
+	Group(g Group) error
+	Unverified(u Unverified) error
+	End(summary Summary) error
+}
+
+// Options for the formats that support them.
+type Options struct {
+	// show how the file to keep was chosen (json and ndjson always do)
+	Explain bool
+	// for fdupes, precede each group with the size of its files, like
+	// fdupes -S
+	ShowSize bool
+	// for fdupes, write each group on a single line, like fdupes -1
+	SameLine bool
+}
+
+var formats = map[string]func(w io.Writer, opts Options) Reporter{
+	"text":   newTextReporter,
+	"json":   newJSONReporter,
+	"ndjson": newNDJSONReporter,
+	"csv":    newCSVReporter,
+	"fdupes": newFdupesReporter,
+	"rdfind": newRdfindReporter,
+	"html":   newHTMLReporter,
+}
+
+// Creates a reporter for the named format, writing to w.
+func New(format string, w io.Writer, opts Options) (Reporter, error) {
+	makeReporter, ok := formats[format]
+	if !ok {
+		return nil, errors.New("unknown report format: " + format)
+	}
+	return makeReporter(w, opts), nil
+}
+
+// Returns the names of all the available formats, in sorted order.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Counts of the files processed by the scan that preceded the analysis.
+type ScanSummary struct {
+	FilesFound           uint64 `json:"filesFound"`
+	FilesAdded           uint64 `json:"filesAdded"`
+	FilesChanged         uint64 `json:"filesChanged"`
+	FilesDeleted         uint64 `json:"filesDeleted"`
+	FilesPartiallyHashed uint64 `json:"filesPartiallyHashed"`
+	FilesFullyHashed     uint64 `json:"filesFullyHashed"`
+}
+
+// Totals over a whole analysis.
+type Summary struct {
+	Scan *ScanSummary `json:"scan,omitempty"`
+	// the number of files considered
+	Files int `json:"files"`
+	// the number of groups of duplicates, and of files in them
+	Groups         int `json:"groups"`
+	DuplicateFiles int `json:"duplicateFiles"`
+	// the bytes freed by reducing every group to a single copy
+	Reclaimable int64 `json:"reclaimableBytes"`
+	// whether groups were compared byte-for-byte, and if so, the number
+	// of files that matched by hash but could not be verified
+	Verified        bool `json:"verified"`
+	UnverifiedFiles int  `json:"unverifiedFiles"`
+}
+
+// Adds a group to the totals.
+func (s *Summary) AddGroup(g Group) {
+	s.Groups++
+	s.DuplicateFiles += len(g.Files)
+	s.Reclaimable += g.Reclaimable
+}
+
+// Adds a set of unverified files to the totals.
+func (s *Summary) AddUnverified(u Unverified) {
+	s.UnverifiedFiles += len(u.Files)
+}
+
+// A group of duplicate files.
+type Group struct {
+	HashAlg string `json:"hashAlg"`
+	Hash    string `json:"hash"`
+	Length  int64  `json:"length"`
+	// the bytes freed by reducing the group to a single copy
+	Reclaimable int64 `json:"reclaimableBytes"`
+	// whether the files were compared byte-for-byte
+	Verified bool `json:"verified"`
+	// how the file to keep was chosen
+	KeepReason string `json:"keepReason"`
+	Files      []File `json:"files"`
+}
+
+// A file in a group.
+type File struct {
+	Path    string    `json:"path"`
+	LastMod time.Time `json:"mtime"`
+	// true for the file the keep rules would keep
+	Keep bool `json:"keep,omitempty"`
+	// true for files a keep rule protects
+	Protected bool `json:"protected,omitempty"`
+	// the path of an earlier file in the group that this file is a
+	// hardlink to
+	HardlinkOf string `json:"hardlinkOf,omitempty"`
+	// for unverified files, why they could not be verified:  different,
+	// changed, or unreadable
+	Status string `json:"status,omitempty"`
+	// when several folders are analyzed together, the one the file is in
+	Root string `json:"root,omitempty"`
+	// the underlying file, for formats that need it
+	Device int64 `json:"-"`
+	Inode  int64 `json:"-"`
+}
+
+// Files that matched a group by hash but could not be verified.
+type Unverified struct {
+	HashAlg string `json:"hashAlg"`
+	Hash    string `json:"hash"`
+	Length  int64  `json:"length"`
+	Files   []File `json:"files"`
+}
+
+func newFile(entry filedb.FileEntry) File {
+	return File{Path: entry.Path, LastMod: time.Unix(entry.LastMod, 0).UTC(), Device: entry.Device, Inode: entry.Inode}
+}
+
+// Creates the report for a group of duplicates, marking the file chosen
+// by the decision and any it protects.
+func NewGroup(g *dset.Group, decision keep.Decision, verified bool) Group {
+	first := g.Entries[0]
+	result := Group{
+		HashAlg:     first.HashAlg,
+		Hash:        first.Hash,
+		Length:      first.Length,
+		Reclaimable: g.Reclaimable(),
+		Verified:    verified,
+		KeepReason:  decision.Reason(),
+		Files:       make([]File, len(g.Entries)),
+	}
+	for i, entry := range g.Entries {
+		file := newFile(entry)
+		file.Keep = i == decision.Keeper
+		file.Protected = decision.IsProtected(i)
+		if j, linked := g.LinkedTo(i); linked {
+			file.HardlinkOf = g.Entries[j].Path
+		}
+		result.Files[i] = file
+	}
+	return result
+}
+
+// Creates the report for the files in a verified group that could not
+// be verified.  Returns false if there are none.
+func NewUnverified(r *verify.Result) (Unverified, bool) {
+	var files []File
+	var first *filedb.FileEntry
+	add := func(entries []filedb.FileEntry, status string) {
+		for i := range entries {
+			if first == nil {
+				first = &entries[i]
+			}
+			file := newFile(entries[i])
+			file.Status = status
+			files = append(files, file)
+		}
+	}
+	add(r.Different, "different")
+	add(r.Changed, "changed")
+	add(r.Unreadable, "unreadable")
+	if first == nil {
+		return Unverified{}, false
+	}
+	return Unverified{HashAlg: first.HashAlg, Hash: first.Hash, Length: first.Length, Files: files}, true
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"lostbearlabs.com/ddet/dset"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/keep"
+	"lostbearlabs.com/ddet/verify"
+	"testing"
+)
+
+func testGroup() Group {
+	entries := []filedb.FileEntry{
+		*filedb.NewTestFileEntry().SetPath("/a").SetLastMod(300).SetDevice(1).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/b").SetLastMod(100).SetDevice(1).SetInode(11),
+		*filedb.NewTestFileEntry().SetPath("/c").SetLastMod(200).SetDevice(1).SetInode(10),
+	}
+	rules, _ := keep.ParseRules([]string{"oldest", "never:/c"})
+	return NewGroup(dset.NewGroup(entries), keep.Decide(entries, rules), true)
+}
+
+func TestNewGroup(t *testing.T) {
+	g := testGroup()
+	if g.Hash != filedb.NewTestFileEntry().Hash || g.Length != 128 || g.Reclaimable != 128 || !g.Verified {
+		t.Error("bad group, got ", g)
+	}
+	if g.KeepReason != "decided by oldest" {
+		t.Error("bad keep reason, got ", g.KeepReason)
+	}
+	if g.Files[0].Keep || !g.Files[1].Keep || g.Files[2].Keep {
+		t.Error("wrong file marked to keep, got ", g.Files)
+	}
+	if !g.Files[2].Protected || g.Files[2].HardlinkOf != "/a" {
+		t.Error("bad annotations, got ", g.Files[2])
+	}
+	if g.Files[1].LastMod.Unix() != 100 {
+		t.Error("bad mtime, got ", g.Files[1].LastMod)
+	}
+}
+
+func TestNewUnverified(t *testing.T) {
+	_, ok := NewUnverified(&verify.Result{})
+	if ok {
+		t.Error("should have had nothing to report")
+	}
+
+	result := &verify.Result{
+		Changed:    []filedb.FileEntry{*filedb.NewTestFileEntry().SetPath("/b")},
+		Unreadable: []filedb.FileEntry{*filedb.NewTestFileEntry().SetPath("/c")},
+	}
+	u, ok := NewUnverified(result)
+	if !ok || len(u.Files) != 2 || u.Files[0].Status != "changed" || u.Files[1].Status != "unreadable" || u.Length != 128 {
+		t.Error("bad unverified files, got ", u)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	var s Summary
+	s.AddGroup(testGroup())
+	s.AddGroup(testGroup())
+	s.AddUnverified(Unverified{Files: make([]File, 3)})
+	if s.Groups != 2 || s.DuplicateFiles != 6 || s.Reclaimable != 256 || s.UnverifiedFiles != 3 {
+		t.Error("bad summary, got ", s)
+	}
+}
+
+func TestNewUnknownFormat(t *testing.T) {
+	_, err := New("xml", nil, Options{})
+	if err == nil {
+		t.Error("should have failed for unknown format")
+	}
+}
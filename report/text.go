@@ -0,0 +1,80 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The human-readable format.  Groups are printed as they are found;
+// unverified files are held back and printed after all the groups.
+type textReporter struct {
+	w          io.Writer
+	opts       Options
+	unverified []Unverified
+}
+
+func newTextReporter(w io.Writer, opts Options) Reporter {
+	return &textReporter{w: w, opts: opts}
+}
+
+func (r *textReporter) Begin(roots []string) error {
+	return nil
+}
+
+func (r *textReporter) Group(g Group) error {
+	description := "Files with"
+	if g.Verified {
+		description = "Files verified identical with"
+	}
+	fmt.Fprintf(r.w, "%s %s %s and length %d:\n", description, strings.ToUpper(g.HashAlg), g.Hash, g.Length)
+	for _, file := range g.Files {
+		var notes []string
+		if file.Keep {
+			notes = append(notes, "keep")
+		} else if file.Protected {
+			notes = append(notes, "protected")
+		}
+		if file.HardlinkOf != "" {
+			notes = append(notes, "hardlink of "+file.HardlinkOf)
+		}
+		if file.Root != "" {
+			notes = append(notes, "in "+file.Root)
+		}
+		if len(notes) > 0 {
+			fmt.Fprintf(r.w, "   %s (%s)\n", file.Path, strings.Join(notes, ", "))
+		} else {
+			fmt.Fprintf(r.w, "   %s\n", file.Path)
+		}
+	}
+	if r.opts.Explain {
+		fmt.Fprintf(r.w, "   keep: %s\n", g.KeepReason)
+	}
+	return nil
+}
+
+func (r *textReporter) Unverified(u Unverified) error {
+	r.unverified = append(r.unverified, u)
+	return nil
+}
+
+var statusDescriptions = map[string]string{
+	"different":  "contents differ",
+	"changed":    "changed since last scan",
+	"unreadable": "unreadable",
+}
+
+func (r *textReporter) End(summary Summary) error {
+	for _, u := range r.unverified {
+		fmt.Fprintf(r.w, "Files matching %s %s and length %d that could not be verified:\n", strings.ToUpper(u.HashAlg), u.Hash, u.Length)
+		for _, file := range u.Files {
+			fmt.Fprintf(r.w, "   %s (%s)\n", file.Path, statusDescriptions[file.Status])
+		}
+	}
+
+	if summary.Verified {
+		logger.Infof("verified %d groups of duplicate files, %d files could not be verified", summary.Groups, summary.UnverifiedFiles)
+	}
+	logger.Infof("%d bytes reclaimable", summary.Reclaimable)
+	return nil
+}
@@ -0,0 +1,40 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextReport(t *testing.T) {
+	out := writeTestReport(t, "text")
+
+	expected := `Files verified identical with MD5 8d9ace9df01c0c0876a95c3f810e7e9a and length 128:
+   /a
+   /b (keep)
+   /c (protected, hardlink of /a)
+Files matching MD5 abc and length 5 that could not be verified:
+   /d (contents differ)
+`
+	if out != expected {
+		t.Error("bad report, expected:\n", expected, "got:\n", out)
+	}
+}
+
+func TestTextReportWithRoots(t *testing.T) {
+	var buf bytes.Buffer
+	r, _ := New("text", &buf, Options{})
+	r.Begin([]string{"/data", "/backup"})
+	r.Group(Group{HashAlg: "md5", Hash: "abc", Length: 5, Files: []File{
+		{Path: "/data/a", Keep: true, Root: "/data"},
+		{Path: "/backup/a", Root: "/backup"},
+	}})
+	r.End(Summary{})
+
+	expected := `Files with MD5 abc and length 5:
+   /data/a (keep, in /data)
+   /backup/a (in /backup)
+`
+	if buf.String() != expected {
+		t.Error("bad report, expected:\n", expected, "got:\n", buf.String())
+	}
+}
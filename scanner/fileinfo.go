@@ -1,8 +1,8 @@
 package scanner
 
 import (
-	"crypto/md5"
 	"io"
+	"lostbearlabs.com/ddet/hashing"
 	"os"
 )
 
@@ -10,7 +10,7 @@ import (
 // examine and hash files.
 
 // from: http://dev.pawelsz.eu/2014/11/google-golang-compute-md5-of-file.html
-func ComputeMd5(filePath string) ([]byte, error) {
+func ComputeHash(filePath string, hasher hashing.Hasher) ([]byte, error) {
 	var result []byte
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -18,7 +18,7 @@ func ComputeMd5(filePath string) ([]byte, error) {
 	}
 	defer file.Close()
 
-	hash := md5.New()
+	hash := hasher.New()
 	if _, err := io.Copy(hash, file); err != nil {
 		return result, err
 	}
@@ -26,6 +26,44 @@ func ComputeMd5(filePath string) ([]byte, error) {
 	return hash.Sum(result), nil
 }
 
+// The number of bytes read from each end of a file to compute its
+// partial hash.  Changing this invalidates every partial hash already
+// stored in a FileDB.
+const PartialHashSize = 4096
+
+// Computes the hash of the first and last PartialHashSize bytes of a
+// file.  Files no longer than 2*PartialHashSize are hashed in full, so
+// for them the partial hash is the same as the full hash.
+func ComputePartialHash(filePath string, hasher hashing.Hasher) ([]byte, error) {
+	var result []byte
+	file, err := os.Open(filePath)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return result, err
+	}
+
+	hash := hasher.New()
+	length := stat.Size()
+	if length <= 2*PartialHashSize {
+		if _, err := io.Copy(hash, file); err != nil {
+			return result, err
+		}
+	} else {
+		head := io.NewSectionReader(file, 0, PartialHashSize)
+		tail := io.NewSectionReader(file, length-PartialHashSize, PartialHashSize)
+		if _, err := io.Copy(hash, io.MultiReader(head, tail)); err != nil {
+			return result, err
+		}
+	}
+
+	return hash.Sum(result), nil
+}
+
 // Returns the length and lastModTime for the specified path.
 func GetFileStats(filePath string) (int64, int64, error) {
 	file, err := os.Open(filePath)
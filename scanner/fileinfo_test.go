@@ -2,7 +2,9 @@ package scanner
 
 import (
 	"bytes"
+	"encoding/hex"
 	"io/ioutil"
+	"lostbearlabs.com/ddet/hashing"
 	"os"
 	"testing"
 )
@@ -13,7 +15,7 @@ func TestMd5(t *testing.T) {
 
 	ioutil.WriteFile(file.Name(), []byte("constant text string"), 0644)
 
-	md5, _ := ComputeMd5(file.Name())
+	md5, _ := ComputeHash(file.Name(), hashing.MD5)
 	t.Log("Path=", file.Name(), ", MD5=", md5)
 
 	expected := []byte{196, 84, 116, 50, 184, 145, 163, 237, 46, 107, 22, 229, 141, 66, 249, 123}
@@ -35,3 +37,54 @@ func TestSize(t *testing.T) {
 		t.Error("bad size=", size, ", expected=", expected)
 	}
 }
+
+func TestPartialHashOfSmallFileIsFullHash(t *testing.T) {
+	file, _ := ioutil.TempFile(os.TempDir(), "prefix")
+	defer os.Remove(file.Name())
+
+	ioutil.WriteFile(file.Name(), []byte("constant text string"), 0644)
+
+	full, _ := ComputeHash(file.Name(), hashing.MD5)
+	partial, _ := ComputePartialHash(file.Name(), hashing.MD5)
+	if !bytes.Equal(full, partial) {
+		t.Error("bad partial hash=", partial, ", expected=", full)
+	}
+}
+
+func TestPartialHashIgnoresMiddleOfLargeFile(t *testing.T) {
+	file1, _ := ioutil.TempFile(os.TempDir(), "prefix")
+	defer os.Remove(file1.Name())
+	file2, _ := ioutil.TempFile(os.TempDir(), "prefix")
+	defer os.Remove(file2.Name())
+
+	data := make([]byte, 3*PartialHashSize)
+	ioutil.WriteFile(file1.Name(), data, 0644)
+	data[len(data)/2] = 1
+	ioutil.WriteFile(file2.Name(), data, 0644)
+
+	partial1, _ := ComputePartialHash(file1.Name(), hashing.MD5)
+	partial2, _ := ComputePartialHash(file2.Name(), hashing.MD5)
+	if !bytes.Equal(partial1, partial2) {
+		t.Error("partial hashes should match, got ", partial1, " and ", partial2)
+	}
+
+	full1, _ := ComputeHash(file1.Name(), hashing.MD5)
+	full2, _ := ComputeHash(file2.Name(), hashing.MD5)
+	if bytes.Equal(full1, full2) {
+		t.Error("full hashes should differ, got ", full1)
+	}
+}
+
+func TestHashWithOtherAlgorithm(t *testing.T) {
+	file, _ := ioutil.TempFile(os.TempDir(), "prefix")
+	defer os.Remove(file.Name())
+
+	ioutil.WriteFile(file.Name(), []byte("constant text string"), 0644)
+
+	hash, _ := ComputeHash(file.Name(), hashing.SHA256)
+
+	expected, _ := hex.DecodeString("fed2f36509d93cb8b9e63a8cc65c3743dd59f6b3a6465d5791e7c6f81d4b56bc")
+	if !bytes.Equal(hash, expected) {
+		t.Error("bad hash=", hash, ", expected=", expected)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package scanner
+
+import (
+	"os"
+)
+
+// Returns the device and inode numbers of a file, or zeroes if they
+// aren't available.  They are never available on this platform, so
+// hardlinks are treated as separate copies.
+func getFileIdentity(f os.FileInfo) (int64, int64) {
+	return 0, 0
+}
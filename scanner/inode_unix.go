@@ -0,0 +1,18 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the device and inode numbers of a file, or zeroes if they
+// aren't available.
+func getFileIdentity(f os.FileInfo) (int64, int64) {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return int64(stat.Dev), int64(stat.Ino)
+}
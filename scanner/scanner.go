@@ -4,69 +4,277 @@ import (
 	"encoding/hex"
 	"github.com/juju/loggo"
 	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"lostbearlabs.com/ddet/hashing"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
 	"time"
 )
 
 var logger = loggo.GetLogger("scanner")
 
-// Scanner walks a file tree, updating the FileDB with current information
-// for each file found and collecting some statistics along the way.
+// The number of colliding lengths, or lengths and partial hashes, whose
+// entries are read from the FileDB at once.
+const readBatchSize = 400
+
+// Options controls how much work a Scanner does in parallel.  The walker
+// feeds paths to a pool of stat workers, which compare each file against
+// the FileDB;  files that need hashing are then fed to a pool of hash
+// workers.  Both hand-offs go through bounded queues, so the producer
+// can never get more than QueueSize files ahead of the workers.  Results
+// from both pools are stored by a single database writer in batches of
+// up to BatchSize entries, committed at least once every BatchInterval.
+type Options struct {
+	// number of goroutines that stat files and look them up in the FileDB
+	StatWorkers int
+	// number of goroutines that read and hash file contents
+	HashWorkers int
+	// capacity of each of the queues between pipeline stages
+	QueueSize int
+	// maximum number of entries committed to the FileDB at once
+	BatchSize int
+	// maximum time an entry waits before being committed
+	BatchInterval time.Duration
+	// algorithm used to hash file contents;  files hashed with any
+	// other algorithm by an earlier scan are re-hashed
+	Hasher hashing.Hasher
+	// files to leave out of the scan, by path or size;  excluded
+	// directories are not entered at all, and files outside the size
+	// limits are not hashed
+	Filter *filter.Filter
+	// names of the per-directory ignore files to honor, e.g.
+	// filter.DdetIgnore;  ignored directories are not entered at all
+	IgnoreFiles []string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		StatWorkers:   4,
+		HashWorkers:   runtime.NumCPU(),
+		QueueSize:     1024,
+		BatchSize:     filedb.DefaultBatchSize,
+		BatchInterval: filedb.DefaultBatchInterval,
+		Hasher:        hashing.Default,
+		IgnoreFiles:   []string{filter.DdetIgnore},
+	}
+}
+
+// A file found by the walk.
+type walkedFile struct {
+	path string
+	info os.FileInfo
+}
+
+// A file entry that needs its partial hash or its full hash computed.
+type hashJob struct {
+	entry filedb.FileEntry
+	full  bool
+}
+
+// Identifies one hash of one underlying file, so that a file with
+// several hardlinks is only hashed once per scan.
+type inodeKey struct {
+	device int64
+	inode  int64
+	full   bool
+}
+
+// A hash of an underlying file.  done is closed once the hash has been
+// computed, by whichever hash worker got to the file first.
+type inodeHash struct {
+	done chan struct{}
+	hash string
+	err  error
+}
+
+// Scanner walks one or more file trees, updating the FileDB with current
+// information for each file found and collecting some statistics along
+// the way.  The trees are walked at once, feeding the same stat workers,
+// and are hashed together, so that duplicates are found across them.
+//
+// Files are hashed in stages, so that we only read as much of each file
+// as we need to tell it apart from the others:
+//   - the walk records each file's length, clearing the hashes of any
+//     file that has been added or changed since the last scan, or that
+//     was hashed with a different algorithm
+//   - files whose length is shared with another file get a partial hash
+//   - files whose length and partial hash are both shared with another
+//     file get a full hash
 type Scanner struct {
 	Db    *filedb.FileDB
-	wg    *sync.WaitGroup
+	opts  Options
 	stats *scannerStats
+
+	statQueue chan walkedFile
+	hashQueue chan hashJob
+	writer    *filedb.Writer
+
+	inodeMx *sync.Mutex
+	inodes  map[inodeKey]*inodeHash
 }
 
-func (scanner *Scanner) processFile(path string) {
+// Stat worker:  reads paths from the stat queue and records their
+// current length and lastMod in the database.
+func (scanner *Scanner) statFiles(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for walked := range scanner.statQueue {
+		scanner.statFile(walked.path, walked.info)
+	}
+}
+
+func (scanner *Scanner) statFile(path string, info os.FileInfo) {
 	defer scanner.stats.incFilesScanned()
-	defer scanner.wg.Done()
 
-	length, lastMod, _ := GetFileStats(path)
-	if length == 0 {
+	length := info.Size()
+	lastMod := info.ModTime().Unix()
+	if length == 0 || !scanner.opts.Filter.MatchSize(length) {
 		return
 	}
-	changed, prev := scanner.isFileChanged(path, length, lastMod)
+	device, inode := getFileIdentity(info)
+	changed, prev := scanner.isFileChanged(path, length, lastMod, device, inode)
 
 	if changed {
-		// file has been added or updated ... recompute its MD5
+		// file has been added or updated ... store it without hashes
+		// so that the later stages will recompute them as needed
 		logger.Tracef(" ... changed since last scan: %s", path)
-		md5, _ := ComputeMd5(path)
-		if md5 == nil || len(md5) != 16 {
-			logger.Warningf("unable to read file %s", path)
-			return
+		item := filedb.NewBlankFileEntry().
+			SetPath(path).
+			SetLength(length).
+			SetLastMod(lastMod).
+			SetDevice(device).
+			SetInode(inode).
+			SetHashAlg(scanner.opts.Hasher.Name()).
+			SetScanTime(time.Now().Unix())
+		scanner.writer.Put(*item)
+		if prev == nil {
+			scanner.stats.incFilesAdded(1)
 		} else {
-			item := filedb.NewBlankFileEntry().
-				SetPath(path).
-				SetLength(length).
-				SetLastMod(lastMod).
-				SetMd5(hex.EncodeToString(md5)).
-				SetScanTime(time.Now().Unix())
-			err := scanner.Db.StoreFileEntry(*item)
-			if err != nil {
-				logger.Errorf("Error [%v] storing [%v]", err, item)
-			}
-			if prev == nil {
-				scanner.stats.incFilesAdded(1)
-			} else {
-				scanner.stats.incFilesUpdated()
-			}
+			scanner.stats.incFilesUpdated()
 		}
 	} else {
 		// file has not been updated ... only need to get our current
-		// scan time into the database
+		// scan time into the database (along with the inode, in case
+		// the entry predates our recording it)
+		prev.SetDevice(device).SetInode(inode)
 		prev.SetScanTime(time.Now().Unix())
-		err := scanner.Db.StoreFileEntry(*prev)
+		scanner.writer.Put(*prev)
+	}
+}
+
+// Hash worker:  reads entries from the hash queue, computes the
+// requested hash, and stores the result.
+func (scanner *Scanner) hashFiles(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for job := range scanner.hashQueue {
+		scanner.hashFile(job)
+	}
+}
+
+func (scanner *Scanner) hashFile(job hashJob) {
+	item := job.entry
+
+	// entries from earlier scans of other folders may be out of date;
+	// leave them for the next scan of their own folder
+	info, err := os.Stat(item.Path)
+	if err != nil || info.Size() != item.Length || info.ModTime().Unix() != item.LastMod {
+		logger.Tracef("not hashing %s, it has changed since it was scanned", item.Path)
+		return
+	}
+
+	if job.full {
+		hash, err := scanner.hashOnce(item, true, ComputeHash)
+		if err != nil {
+			logger.Warningf("unable to read file %s: %v", item.Path, err)
+			return
+		}
+		item.SetHash(hash)
+		scanner.stats.incFilesFullyHashed()
+	} else {
+		partial, err := scanner.hashOnce(item, false, ComputePartialHash)
 		if err != nil {
-			logger.Errorf("Error [%v] storing [%v]", err, *prev)
+			logger.Warningf("unable to read file %s: %v", item.Path, err)
+			return
+		}
+		item.SetPartialHash(partial)
+		if item.Length <= 2*PartialHashSize {
+			// the partial hash covered the whole file
+			item.SetHash(item.PartialHash)
 		}
+		scanner.stats.incFilesPartiallyHashed()
 	}
 
+	scanner.writer.Put(item)
 }
 
-func (scanner *Scanner) isFileChanged(path string, length int64, lastMod int64) (bool, *filedb.FileEntry) {
+// Computes a hash of the entry's file, unless it has already been
+// computed during this scan for another hardlink to the same file.
+func (scanner *Scanner) hashOnce(item filedb.FileEntry, full bool, compute func(string, hashing.Hasher) ([]byte, error)) (string, error) {
+	if item.Inode == 0 {
+		hash, err := compute(item.Path, scanner.opts.Hasher)
+		return hex.EncodeToString(hash), err
+	}
+
+	key := inodeKey{item.Device, item.Inode, full}
+	scanner.inodeMx.Lock()
+	ih, found := scanner.inodes[key]
+	if !found {
+		ih = &inodeHash{done: make(chan struct{})}
+		scanner.inodes[key] = ih
+	}
+	scanner.inodeMx.Unlock()
+
+	if found {
+		<-ih.done
+		return ih.hash, ih.err
+	}
+
+	hash, err := compute(item.Path, scanner.opts.Hasher)
+	ih.hash = hex.EncodeToString(hash)
+	ih.err = err
+	close(ih.done)
+	return ih.hash, ih.err
+}
+
+// Runs the entries returned by read through the pool of hash workers,
+// returning once they have all been hashed.  The entries are read for
+// the given number of colliding keys, in batches of up to readBatchSize
+// keys;  read is given the range of keys in each batch.
+// Returns the number of entries read.
+func (scanner *Scanner) hashEntries(keys int, read func(from int, to int) ([]filedb.FileEntry, error), full bool) (int, error) {
+	scanner.hashQueue = make(chan hashJob, scanner.opts.QueueSize)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < scanner.opts.HashWorkers; i++ {
+		wg.Add(1)
+		go scanner.hashFiles(wg)
+	}
+
+	count := 0
+	var err error
+	for from := 0; from < keys; from += readBatchSize {
+		to := from + readBatchSize
+		if to > keys {
+			to = keys
+		}
+		var entries []filedb.FileEntry
+		entries, err = read(from, to)
+		if err != nil {
+			break
+		}
+		for _, entry := range entries {
+			scanner.hashQueue <- hashJob{entry, full}
+		}
+		count += len(entries)
+	}
+
+	close(scanner.hashQueue)
+	wg.Wait()
+	return count, err
+}
+
+func (scanner *Scanner) isFileChanged(path string, length int64, lastMod int64, device int64, inode int64) (bool, *filedb.FileEntry) {
 
 	prev := scanner.Db.ReadFileEntry(path)
 
@@ -74,7 +282,12 @@ func (scanner *Scanner) isFileChanged(path string, length int64, lastMod int64)
 		return true, nil
 	}
 
-	rc := prev.Length != length || prev.LastMod != lastMod
+	rc := prev.Length != length || prev.LastMod != lastMod || prev.HashAlg != scanner.opts.Hasher.Name()
+	if prev.Inode != 0 {
+		// a different underlying file may have different contents,
+		// even with the same length and lastMod
+		rc = rc || prev.Device != device || prev.Inode != inode
+	}
 	return rc, prev
 }
 
@@ -86,52 +299,186 @@ func isRegularFile(f os.FileInfo) bool {
 	return (f.Mode() & os.ModeType) == 0
 }
 
-func (scanner *Scanner) visit(path string, f os.FileInfo, err error) error {
-	if isRegularFile(f) {
+// The walk of one of the trees being scanned.
+type walk struct {
+	scanner *Scanner
+	root    string
+	ignores *filter.IgnoreStack
+}
+
+func (w *walk) visit(path string, f os.FileInfo, err error) error {
+	scanner := w.scanner
+	if f != nil && f.IsDir() {
+		if path != w.root {
+			if scanner.opts.Filter.SkipDir(path) {
+				logger.Tracef("skipping excluded folder %s", path)
+				return filepath.SkipDir
+			}
+			if w.ignores.Ignored(path, true) {
+				logger.Tracef("skipping ignored folder %s", path)
+				return filepath.SkipDir
+			}
+		}
+		w.ignores.EnterDir(path)
+		return nil
+	}
+
+	if isRegularFile(f) && scanner.opts.Filter.MatchFile(path) && !w.ignores.Ignored(path, false) {
 		//log.Trace("visited: %s", path)
 
-		scanner.wg.Add(1)
 		scanner.stats.incFilesFound()
-		go scanner.processFile(path)
+		scanner.statQueue <- walkedFile{path, f}
 	}
 	return nil
 }
 
-func (scanner *Scanner) ScanFiles(dir string) error {
+// Scans the folders, which should not be inside one another.
+func (scanner *Scanner) ScanFiles(dirs ...string) error {
 	scanTime := time.Now().Unix()
-	logger.Infof("Scanning folder %v", dir)
+	for _, dir := range dirs {
+		logger.Infof("Scanning folder %v", dir)
+	}
 
-	// Walk the file tree, and kick off a separate parallel goroutine
-	// to process each file that's visited.
-	filepath.Walk(dir, scanner.visit)
+	scanner.writer = scanner.Db.NewWriter(scanner.opts.BatchSize, scanner.opts.BatchInterval)
+	err := scanner.scanFiles(dirs, scanTime)
+	closeErr := scanner.writer.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (scanner *Scanner) scanFiles(dirs []string, scanTime int64) error {
+	scanner.statQueue = make(chan walkedFile, scanner.opts.QueueSize)
+	scanner.inodes = make(map[inodeKey]*inodeHash)
+
+	statWg := new(sync.WaitGroup)
+	for i := 0; i < scanner.opts.StatWorkers; i++ {
+		statWg.Add(1)
+		go scanner.statFiles(statWg)
+	}
+
+	// Walk the file trees, feeding each file that's visited to the
+	// stat workers.  A walk blocks whenever the queue is full.
+	walkWg := new(sync.WaitGroup)
+	for _, dir := range dirs {
+		w := &walk{scanner: scanner, root: dir, ignores: filter.NewIgnoreStack(scanner.opts.IgnoreFiles...)}
+		walkWg.Add(1)
+		go func() {
+			defer walkWg.Done()
+			filepath.Walk(w.root, w.visit)
+		}()
+	}
+	walkWg.Wait()
 	logger.Tracef("all visited")
 
-	// Wait until all visited files are processed
-	scanner.wg.Wait()
+	// Wait until all visited files are processed and stored.
+	close(scanner.statQueue)
+	statWg.Wait()
+	err := scanner.writer.Flush()
+	if err != nil {
+		return err
+	}
 	logger.Tracef("all processed")
 
 	// Clean up any old database entries that were not refreshed
-	// during this scan.
-	deleted, err := scanner.Db.DeleteOldEntries(dir, scanTime)
+	// during this scan, so that we don't try to hash them below.
+	for _, dir := range dirs {
+		deleted, err := scanner.Db.DeleteOldEntries(dir, scanTime)
+		if err != nil {
+			return err
+		}
+		scanner.stats.incFilesDeleted(deleted)
+	}
+
+	// Compute partial hashes for files whose lengths collide, including
+	// files from earlier scans of other folders.
+	hashAlg := scanner.opts.Hasher.Name()
+	lengths, err := scanner.Db.ReadCollidingLengths(dirs...)
+	if err != nil {
+		return err
+	}
+	count, err := scanner.hashEntries(len(lengths), func(from int, to int) ([]filedb.FileEntry, error) {
+		return scanner.Db.ReadFileEntriesNeedingPartialHash(hashAlg, lengths[from:to])
+	}, false)
+	if err != nil {
+		return err
+	}
+	logger.Tracef("%d files needed partial hashes", count)
+	err = scanner.writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	// Compute full hashes for files whose partial hashes collide.
+	keys, err := scanner.Db.ReadCollidingPartialHashes(hashAlg, dirs...)
+	if err != nil {
+		return err
+	}
+	count, err = scanner.hashEntries(len(keys), func(from int, to int) ([]filedb.FileEntry, error) {
+		return scanner.Db.ReadFileEntriesNeedingFullHash(hashAlg, keys[from:to])
+	}, true)
 	if err != nil {
 		return err
 	}
-	scanner.stats.incFilesDeleted(deleted)
+	logger.Tracef("%d files needed full hashes", count)
+	logger.Tracef("all hashed")
 
 	return nil
 }
 
 func (scanner *Scanner) PrintSummary(final bool) {
 	if final {
-		logger.Infof("found %v files, %v added, %v changed, %v deleted\n", scanner.stats.getFilesFound(), scanner.stats.getFilesAdded(),
-			scanner.stats.getFilesUpdated(), scanner.stats.getFilesDeleted())
+		logger.Infof("found %v files, %v added, %v changed, %v deleted, %v partially hashed, %v fully hashed\n",
+			scanner.stats.getFilesFound(), scanner.stats.getFilesAdded(), scanner.stats.getFilesUpdated(),
+			scanner.stats.getFilesDeleted(), scanner.stats.getFilesPartiallyHashed(), scanner.stats.getFilesFullyHashed())
 	} else {
-		logger.Infof("... processed %v/%v files\n", scanner.stats.getFilesScanned(), scanner.stats.getFilesFound())
+		logger.Infof("... processed %v/%v files, %v partially hashed, %v fully hashed\n",
+			scanner.stats.getFilesScanned(), scanner.stats.getFilesFound(),
+			scanner.stats.getFilesPartiallyHashed(), scanner.stats.getFilesFullyHashed())
 	}
 }
 
-func MakeScanner(db *filedb.FileDB) Scanner {
-	wg := new(sync.WaitGroup)
+// Counts of the files processed by a scan.
+type Summary struct {
+	FilesFound           uint64
+	FilesAdded           uint64
+	FilesUpdated         uint64
+	FilesDeleted         uint64
+	FilesPartiallyHashed uint64
+	FilesFullyHashed     uint64
+}
+
+// Returns the counts of the files processed so far.
+func (scanner *Scanner) Summary() Summary {
+	return Summary{
+		FilesFound:           scanner.stats.getFilesFound(),
+		FilesAdded:           scanner.stats.getFilesAdded(),
+		FilesUpdated:         scanner.stats.getFilesUpdated(),
+		FilesDeleted:         scanner.stats.getFilesDeleted(),
+		FilesPartiallyHashed: scanner.stats.getFilesPartiallyHashed(),
+		FilesFullyHashed:     scanner.stats.getFilesFullyHashed(),
+	}
+}
+
+// Creates a Scanner.  Pool, queue, and batch sizes less than one are
+// treated as one.
+func MakeScanner(db *filedb.FileDB, opts Options) Scanner {
+	if opts.StatWorkers < 1 {
+		opts.StatWorkers = 1
+	}
+	if opts.HashWorkers < 1 {
+		opts.HashWorkers = 1
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 1
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
+	}
+	if opts.Hasher == nil {
+		opts.Hasher = hashing.Default
+	}
 	stats := newScannerStats()
-	return Scanner{db, wg, stats}
+	return Scanner{Db: db, opts: opts, stats: stats, inodeMx: new(sync.Mutex)}
 }
@@ -1,8 +1,11 @@
 package scanner
 
 import (
+	"fmt"
 	"io/ioutil"
 	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/filter"
+	"lostbearlabs.com/ddet/hashing"
 	"os"
 	"testing"
 )
@@ -31,7 +34,7 @@ func TestScan(t *testing.T) {
 	db, _ := filedb.NewTempDB()
 	defer db.Close()
 
-	scanner := MakeScanner(db)
+	scanner := MakeScanner(db, DefaultOptions())
 	scanner.ScanFiles(dir)
 
 	allFileEntriess, _ := db.ReadAllFileEntries()
@@ -55,11 +58,11 @@ func TestScanUnchangedFile(t *testing.T) {
 	db, _ := filedb.NewTempDB()
 	defer db.Close()
 
-	scanner := MakeScanner(db)
+	scanner := MakeScanner(db, DefaultOptions())
 	scanner.ScanFiles(dir)
 	read1 := db.ReadFileEntry(name1)
 
-	scanner2 := MakeScanner(db)
+	scanner2 := MakeScanner(db, DefaultOptions())
 	scanner2.ScanFiles(dir)
 	read2 := db.ReadFileEntry(name1)
 
@@ -80,7 +83,7 @@ func TestScanChangedFile(t *testing.T) {
 	db, _ := filedb.NewTempDB()
 	defer db.Close()
 
-	scanner := MakeScanner(db)
+	scanner := MakeScanner(db, DefaultOptions())
 	scanner.ScanFiles(dir)
 
 	read1 := db.ReadFileEntry(name1)
@@ -89,7 +92,7 @@ func TestScanChangedFile(t *testing.T) {
 	// unless we stick a sleep in here?)
 	ioutil.WriteFile(name1, []byte("constant text string 22"), 0644)
 
-	scanner2 := MakeScanner(db)
+	scanner2 := MakeScanner(db, DefaultOptions())
 	scanner2.ScanFiles(dir)
 	read2 := db.ReadFileEntry(name1)
 
@@ -98,3 +101,340 @@ func TestScanChangedFile(t *testing.T) {
 	}
 
 }
+
+func TestScanWithMinimalPool(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("%s/file%02d", dir, i)
+		ioutil.WriteFile(name, []byte(fmt.Sprintf("constant text string %d", i)), 0644)
+	}
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	scanner := MakeScanner(db, Options{StatWorkers: 1, HashWorkers: 1, QueueSize: 1})
+	scanner.ScanFiles(dir)
+
+	allFileEntries, _ := db.ReadAllFileEntries()
+	if len(allFileEntries) != 50 {
+		t.Error("wrong length, expected=50, got=", len(allFileEntries))
+	}
+}
+
+func TestScanHashesOnlyCollidingFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	small := make([]byte, 16)
+	large := make([]byte, 3*PartialHashSize)
+
+	// unique length: never hashed
+	ioutil.WriteFile(dir+"/unique", small[:5], 0644)
+
+	// same length, different start: partial hash only
+	ioutil.WriteFile(dir+"/head1", large, 0644)
+	large[0] = 1
+	ioutil.WriteFile(dir+"/head2", large, 0644)
+	large[0] = 0
+
+	// same length, start, and end: full hash
+	large[0] = 2
+	ioutil.WriteFile(dir+"/mid1", large, 0644)
+	large[len(large)/2] = 1
+	ioutil.WriteFile(dir+"/mid2", large, 0644)
+	ioutil.WriteFile(dir+"/mid3", large, 0644)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	scanner := MakeScanner(db, DefaultOptions())
+	scanner.ScanFiles(dir)
+
+	unique := db.ReadFileEntry(dir + "/unique")
+	if unique.PartialHash != "" || unique.Hash != "" {
+		t.Error("unique file should not have been hashed, got ", unique)
+	}
+
+	for _, name := range []string{"/head1", "/head2"} {
+		head := db.ReadFileEntry(dir + name)
+		if head.PartialHash == "" || head.Hash != "" {
+			t.Error("file should only have been partially hashed, got ", head)
+		}
+	}
+
+	mid1 := db.ReadFileEntry(dir + "/mid1")
+	mid2 := db.ReadFileEntry(dir + "/mid2")
+	mid3 := db.ReadFileEntry(dir + "/mid3")
+	if mid1.Hash == "" || mid2.Hash == "" || mid3.Hash == "" {
+		t.Error("files should have been fully hashed, got ", mid1, mid2, mid3)
+	}
+	if mid1.PartialHash != mid2.PartialHash || mid1.Hash == mid2.Hash || mid2.Hash != mid3.Hash {
+		t.Error("wrong hashes, got ", mid1, mid2, mid3)
+	}
+
+	summary := scanner.Summary()
+	expected := Summary{FilesFound: 6, FilesAdded: 6, FilesPartiallyHashed: 5, FilesFullyHashed: 3}
+	if summary != expected {
+		t.Error("wrong summary, expected=", expected, ", got=", summary)
+	}
+}
+
+func TestScanSeveralRoots(t *testing.T) {
+	dir1, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir1)
+	dir2, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir2)
+
+	// each root has one file of this length, so only scanning them
+	// together hashes them
+	large := make([]byte, 3*PartialHashSize)
+	ioutil.WriteFile(dir1+"/copy", large, 0644)
+	ioutil.WriteFile(dir2+"/copy", large, 0644)
+	ioutil.WriteFile(dir2+"/other", []byte("constant text string 1"), 0644)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	scanner := MakeScanner(db, DefaultOptions())
+	scanner.ScanFiles(dir1, dir2)
+
+	copy1 := db.ReadFileEntry(dir1 + "/copy")
+	copy2 := db.ReadFileEntry(dir2 + "/copy")
+	if copy1 == nil || copy2 == nil || copy1.Hash == "" || copy1.Hash != copy2.Hash {
+		t.Error("copies in different roots should have been hashed, got ", copy1, copy2)
+	}
+
+	summary := scanner.Summary()
+	expected := Summary{FilesFound: 3, FilesAdded: 3, FilesPartiallyHashed: 2, FilesFullyHashed: 2}
+	if summary != expected {
+		t.Error("wrong summary, expected=", expected, ", got=", summary)
+	}
+}
+
+func TestScanHashesAgainstEarlierScans(t *testing.T) {
+	dir1, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir1)
+	dir2, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir2)
+
+	large := make([]byte, 3*PartialHashSize)
+	ioutil.WriteFile(dir1+"/copy", large, 0644)
+	ioutil.WriteFile(dir1+"/changed", []byte("constant text string 1"), 0644)
+	ioutil.WriteFile(dir2+"/copy", large, 0644)
+	ioutil.WriteFile(dir2+"/other", []byte("constant text string 2"), 0644)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	// the first root has nothing to collide with when it is scanned
+	// alone, and one of its files changes before the second is scanned
+	first := MakeScanner(db, DefaultOptions())
+	first.ScanFiles(dir1)
+	changed := db.ReadFileEntry(dir1 + "/changed")
+	changed.SetLastMod(changed.LastMod - 1)
+	db.StoreFileEntry(*changed)
+
+	scanner := MakeScanner(db, DefaultOptions())
+	scanner.ScanFiles(dir2)
+
+	copy1 := db.ReadFileEntry(dir1 + "/copy")
+	copy2 := db.ReadFileEntry(dir2 + "/copy")
+	if copy1 == nil || copy2 == nil || copy1.Hash == "" || copy1.Hash != copy2.Hash {
+		t.Error("the copy from the earlier scan should have been hashed, got ", copy1, copy2)
+	}
+	if changed = db.ReadFileEntry(dir1 + "/changed"); changed.PartialHash != "" {
+		t.Error("a file changed since the earlier scan should not have been hashed, got ", changed)
+	}
+
+	summary := scanner.Summary()
+	expected := Summary{FilesFound: 2, FilesAdded: 2, FilesPartiallyHashed: 3, FilesFullyHashed: 2}
+	if summary != expected {
+		t.Error("wrong summary, expected=", expected, ", got=", summary)
+	}
+}
+
+func TestScanRehashesWithNewAlgorithm(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	name1 := dir + "/file1"
+	name2 := dir + "/file2"
+	ioutil.WriteFile(name1, []byte("constant text string"), 0644)
+	ioutil.WriteFile(name2, []byte("constant text string"), 0644)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	scanner := MakeScanner(db, DefaultOptions())
+	scanner.ScanFiles(dir)
+	read1 := db.ReadFileEntry(name1)
+
+	opts := DefaultOptions()
+	opts.Hasher = hashing.SHA256
+	scanner2 := MakeScanner(db, opts)
+	scanner2.ScanFiles(dir)
+	read2 := db.ReadFileEntry(name1)
+
+	if read1.HashAlg != "md5" || read1.Hash != "c4547432b891a3ed2e6b16e58d42f97b" {
+		t.Error("bad first scan, got ", read1)
+	}
+	if read2.HashAlg != "sha256" || read2.Hash != "fed2f36509d93cb8b9e63a8cc65c3743dd59f6b3a6465d5791e7c6f81d4b56bc" {
+		t.Error("bad second scan, got ", read2)
+	}
+}
+
+func TestScanSkipsExcludedFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(dir+"/.git/objects", 0755)
+	ioutil.WriteFile(dir+"/file1", []byte("constant text string 1"), 0644)
+	ioutil.WriteFile(dir+"/file2.tmp", []byte("constant text string 22"), 0644)
+	ioutil.WriteFile(dir+"/.git/objects/file3", []byte("constant text string 333"), 0644)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	opts := DefaultOptions()
+	opts.Filter = filter.New()
+	opts.Filter.Exclude(".git")
+	opts.Filter.Exclude("*.tmp")
+	scanner := MakeScanner(db, opts)
+	scanner.ScanFiles(dir)
+
+	allFileEntries, _ := db.ReadAllFileEntries()
+	if len(allFileEntries) != 1 {
+		t.Error("wrong length, expected=1, got=", len(allFileEntries))
+		return
+	}
+	confirmItem(t, allFileEntries[0], dir+"/file1", 22)
+}
+
+func TestScanHonorsIgnoreFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(dir+"/gen", 0755)
+	os.MkdirAll(dir+"/src", 0755)
+	ioutil.WriteFile(dir+"/.ddetignore", []byte("gen/\n"), 0644)
+	ioutil.WriteFile(dir+"/src/.gitignore", []byte("*.o\n"), 0644)
+	ioutil.WriteFile(dir+"/gen/file1", []byte("constant text string 1"), 0644)
+	ioutil.WriteFile(dir+"/src/file2.o", []byte("constant text string 22"), 0644)
+	ioutil.WriteFile(dir+"/src/file3", []byte("constant text string 333"), 0644)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	scanner := MakeScanner(db, DefaultOptions())
+	scanner.ScanFiles(dir)
+
+	if db.ReadFileEntry(dir+"/gen/file1") != nil {
+		t.Error("file in ignored folder should not have been scanned")
+	}
+	if db.ReadFileEntry(dir+"/src/file2.o") == nil {
+		t.Error(".gitignore should not be honored by default")
+	}
+
+	db2, _ := filedb.NewTempDB()
+	defer db2.Close()
+
+	opts := DefaultOptions()
+	opts.IgnoreFiles = append(opts.IgnoreFiles, filter.GitIgnore)
+	scanner2 := MakeScanner(db2, opts)
+	scanner2.ScanFiles(dir)
+
+	if db2.ReadFileEntry(dir+"/src/file2.o") != nil {
+		t.Error("file ignored by .gitignore should not have been scanned")
+	}
+	if db2.ReadFileEntry(dir+"/src/file3") == nil {
+		t.Error("file not ignored should have been scanned")
+	}
+}
+
+func TestScanSkipsFilesOutsideSizeLimits(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(dir+"/file1", []byte("1"), 0644)
+	ioutil.WriteFile(dir+"/file2", []byte("constant text string 22"), 0644)
+	ioutil.WriteFile(dir+"/file3", make([]byte, 1000), 0644)
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	opts := DefaultOptions()
+	opts.Filter = filter.New()
+	opts.Filter.SetMinSize(2)
+	opts.Filter.SetMaxSize(999)
+	scanner := MakeScanner(db, opts)
+	scanner.ScanFiles(dir)
+
+	allFileEntries, _ := db.ReadAllFileEntries()
+	if len(allFileEntries) != 1 {
+		t.Error("wrong length, expected=1, got=", len(allFileEntries))
+		return
+	}
+	confirmItem(t, allFileEntries[0], dir+"/file2", 23)
+}
+
+func TestScanRecordsHardlinks(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(dir+"/file1", []byte("constant text string"), 0644)
+	ioutil.WriteFile(dir+"/file2", []byte("constant text string"), 0644)
+	if err := os.Link(dir+"/file1", dir+"/link1"); err != nil {
+		t.Skip("hardlinks not supported: ", err)
+	}
+
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	scanner := MakeScanner(db, DefaultOptions())
+	scanner.ScanFiles(dir)
+
+	file1 := db.ReadFileEntry(dir + "/file1")
+	file2 := db.ReadFileEntry(dir + "/file2")
+	link1 := db.ReadFileEntry(dir + "/link1")
+	if file1.Inode == 0 {
+		t.Skip("inodes not supported")
+	}
+	if !file1.IsSameFile(link1) || file1.IsSameFile(file2) {
+		t.Error("wrong inodes, got ", file1, file2, link1)
+	}
+	if file1.Hash == "" || file1.Hash != link1.Hash || file1.Hash != file2.Hash {
+		t.Error("wrong hashes, got ", file1, file2, link1)
+	}
+}
+
+func TestHashOncePerInode(t *testing.T) {
+	db, _ := filedb.NewTempDB()
+	defer db.Close()
+
+	scanner := MakeScanner(db, DefaultOptions())
+	scanner.inodes = make(map[inodeKey]*inodeHash)
+
+	count := 0
+	compute := func(path string, hasher hashing.Hasher) ([]byte, error) {
+		count++
+		return []byte(path), nil
+	}
+
+	entry1 := *filedb.NewTestFileEntry().SetPath("a").SetDevice(1).SetInode(2)
+	entry2 := *filedb.NewTestFileEntry().SetPath("b").SetDevice(1).SetInode(2)
+	entry3 := *filedb.NewTestFileEntry().SetPath("c").SetDevice(1).SetInode(3)
+
+	hash1, _ := scanner.hashOnce(entry1, true, compute)
+	hash2, _ := scanner.hashOnce(entry2, true, compute)
+	hash3, _ := scanner.hashOnce(entry3, true, compute)
+	scanner.hashOnce(entry1, false, compute)
+
+	if count != 3 {
+		t.Error("wrong number of hashes computed, expected=3, got=", count)
+	}
+	if hash1 != hash2 || hash1 == hash3 {
+		t.Error("wrong hashes, got ", hash1, hash2, hash3)
+	}
+}
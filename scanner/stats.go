@@ -12,6 +12,9 @@ type scannerStats struct {
 	filesUpdated uint64
 	filesDeleted uint64
 	filesAdded   uint64
+
+	filesPartiallyHashed uint64
+	filesFullyHashed     uint64
 }
 
 func newScannerStats() *scannerStats {
@@ -33,6 +36,12 @@ func (stats *scannerStats) incFilesDeleted(num uint64) {
 func (stats *scannerStats) incFilesAdded(num uint64) {
 	atomic.AddUint64(&stats.filesAdded, num)
 }
+func (stats *scannerStats) incFilesPartiallyHashed() {
+	atomic.AddUint64(&stats.filesPartiallyHashed, 1)
+}
+func (stats *scannerStats) incFilesFullyHashed() {
+	atomic.AddUint64(&stats.filesFullyHashed, 1)
+}
 
 func (stats *scannerStats) getFilesScanned() uint64 {
 	return atomic.LoadUint64(&stats.filesScanned)
@@ -49,3 +58,9 @@ func (stats *scannerStats) getFilesDeleted() uint64 {
 func (stats *scannerStats) getFilesAdded() uint64 {
 	return atomic.LoadUint64(&stats.filesAdded)
 }
+func (stats *scannerStats) getFilesPartiallyHashed() uint64 {
+	return atomic.LoadUint64(&stats.filesPartiallyHashed)
+}
+func (stats *scannerStats) getFilesFullyHashed() uint64 {
+	return atomic.LoadUint64(&stats.filesFullyHashed)
+}
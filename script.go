@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"lostbearlabs.com/ddet/dset"
+	"lostbearlabs.com/ddet/keep"
+	"lostbearlabs.com/ddet/script"
+	"lostbearlabs.com/ddet/verify"
+	"os"
+	"text/template"
+)
+
+// The "script" command:  scans a folder, then writes a shell script
+// that acts on the duplicates, for a person to review and run.
+func runScript(args []string) int {
+	flags := newFlagSet("ddet script", "ddet script <folder> [-action rm|ln] [-o FILE] [-v] [options]")
+	sf := addScanFlags(flags)
+	kf := addKeepFlags(flags)
+	actionName := flags.String("action", script.ActionRemove, "what the script does with duplicates: rm to remove them, or ln to replace them with hardlinks")
+	templatePath := flags.String("template", "", "Go template to write instead of the shell script")
+	outPath := flags.String("o", "", "file to write the script to (default stdout)")
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	opts, err := sf.options(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	rules, err := kf.rules(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one folder"))
+	}
+	path := paths[0]
+	s, err := script.New(*actionName, path)
+	if err != nil {
+		return usageError(flags, err)
+	}
+
+	tmpl := script.DefaultTemplate()
+	if *templatePath != "" {
+		tmpl, err = script.ParseTemplate(*templatePath)
+		if err != nil {
+			return commandError(err)
+		}
+	}
+
+	db, err := sf.openFoldersAndDB(path)
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	_, err = scanFiles([]string{path}, db, opts)
+	if err != nil {
+		return commandError(err)
+	}
+
+	// only files that really are identical go in the script
+	ks, dupKeys := findDuplicates(db, []string{path}, opts.Filter)
+	for _, key := range dupKeys {
+		entries, err := ks.GetFileEntries(db, key)
+		if err != nil {
+			return commandError(err)
+		}
+		entries = dset.EntriesWithin(entries, path)
+		if len(entries) < 2 {
+			continue
+		}
+		for _, identical := range verify.Group(entries).Identical {
+			s.AddGroup(identical, keep.Decide(identical, rules))
+		}
+	}
+
+	err = writeScript(s, tmpl, *outPath)
+	if err != nil {
+		return commandError(err)
+	}
+	logger.Infof("wrote %d groups, %d files, %d bytes to be reclaimed", len(s.Groups), s.NumTargets, s.Reclaimable)
+	if len(s.Groups) > 0 {
+		return exitDuplicates
+	}
+	return exitOK
+}
+
+// Writes the script to the file, or to stdout if no file is named.
+func writeScript(s *script.Script, tmpl *template.Template, outPath string) error {
+	var out io.Writer = os.Stdout
+	if outPath != "" {
+		f, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return s.Write(out, tmpl)
+}
@@ -0,0 +1,261 @@
+package script
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/keep"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The actions a script can take on the files that aren't kept.
+const (
+	ActionRemove = "rm"
+	ActionLink   = "ln"
+)
+
+// A script for reviewing and then acting on groups of duplicates.  A
+// Script is filled in with AddGroup(), then rendered with a template;
+// the fields below are what the template sees.
+type Script struct {
+	// rm or ln
+	Action string
+	// the folder that was scanned
+	Root      string
+	Generated time.Time
+	Groups    []Group
+	// the hash algorithms used by any of the groups, in sorted order
+	HashAlgs []string
+	// the number of files to act on, over all the groups
+	NumTargets int
+	// the bytes freed by acting on every target, over all the groups
+	Reclaimable int64
+}
+
+// One group of identical files.
+type Group struct {
+	Keeper filedb.FileEntry
+	// how the keeper was chosen
+	Reason string
+	// the files to act on
+	Targets []filedb.FileEntry
+	// the files that a keep rule says to leave alone
+	Protected []filedb.FileEntry
+	// the bytes freed by acting on every target
+	Reclaimable int64
+}
+
+func New(action string, root string) (*Script, error) {
+	if action != ActionRemove && action != ActionLink {
+		return nil, errors.New("unknown script action: " + action)
+	}
+	return &Script{Action: action, Root: root, Generated: time.Now()}, nil
+}
+
+// Adds a group of identical files, keeping the one chosen by the
+// decision.  When linking, files that are already hardlinks to the
+// keeper are left out, since there is nothing to do for them.
+func (s *Script) AddGroup(entries []filedb.FileEntry, decision keep.Decision) {
+	g := Group{Keeper: entries[decision.Keeper], Reason: decision.Reason()}
+	seen := make(map[[2]int64]bool)
+	for i, entry := range entries {
+		switch {
+		case i == decision.Keeper:
+			continue
+		case decision.IsProtected(i):
+			g.Protected = append(g.Protected, entry)
+			continue
+		case s.Action == ActionLink && entry.IsSameFile(&g.Keeper):
+			continue
+		}
+		g.Targets = append(g.Targets, entry)
+
+		// only the last link to a file frees its space
+		if entry.IsSameFile(&g.Keeper) {
+			continue
+		}
+		if entry.Inode != 0 {
+			id := [2]int64{entry.Device, entry.Inode}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		g.Reclaimable += entry.Length
+	}
+	if len(g.Targets) == 0 {
+		return
+	}
+
+	s.Groups = append(s.Groups, g)
+	s.NumTargets += len(g.Targets)
+	s.Reclaimable += g.Reclaimable
+	i := sort.SearchStrings(s.HashAlgs, g.Keeper.HashAlg)
+	if i == len(s.HashAlgs) || s.HashAlgs[i] != g.Keeper.HashAlg {
+		s.HashAlgs = append(s.HashAlgs, "")
+		copy(s.HashAlgs[i+1:], s.HashAlgs[i:])
+		s.HashAlgs[i] = g.Keeper.HashAlg
+	}
+}
+
+// Renders the script with the template, e.g. DefaultTemplate().
+func (s *Script) Write(w io.Writer, tmpl *template.Template) error {
+	return tmpl.Execute(w, s)
+}
+
+// Quotes a string for a POSIX shell, so that it is passed to a command
+// as a single argument no matter what characters are in it.
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Makes a string safe to put in a shell comment.  Strings containing
+// newlines or other control characters are escaped, since a newline
+// would end the comment.
+func Comment(s string) string {
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// Shell commands that print the hash of their standard input, for each
+// algorithm, in order of preference.  Each prints the hash as lowercase
+// hex, possibly followed by a space and more text.
+var hashCommands = map[string][]string{
+	"md5":    {"md5sum", "md5 -q"},
+	"sha256": {"sha256sum", "shasum -a 256"},
+	"blake3": {"b3sum"},
+	"xxhash": {"xxhsum -H1"},
+}
+
+// Returns a shell command that prints the hash of its standard input,
+// using the first of the usual tools that is installed.
+func HashCommand(alg string) string {
+	commands := hashCommands[alg]
+	if len(commands) == 0 {
+		return "{ echo \"ddet: no tool to compute " + alg + " hashes\" >&2; echo; }"
+	}
+	var b strings.Builder
+	for i, command := range commands {
+		if i == 0 {
+			b.WriteString("if ")
+		} else {
+			b.WriteString(" elif ")
+		}
+		tool := strings.Fields(command)[0]
+		b.WriteString("command -v " + tool + " >/dev/null 2>&1; then " + command + ";")
+	}
+	b.WriteString(" else echo \"ddet: no tool to compute " + alg + " hashes\" >&2; echo; fi")
+	return b.String()
+}
+
+// The functions available to templates, in addition to the standard ones.
+var funcs = template.FuncMap{
+	"quote":       Quote,
+	"comment":     Comment,
+	"hashCommand": HashCommand,
+	"upper":       strings.ToUpper,
+	"add":         func(a, b int) int { return a + b },
+}
+
+// Returns the template for a POSIX shell script.
+func DefaultTemplate() *template.Template {
+	return template.Must(template.New("script").Funcs(funcs).Parse(defaultTemplate))
+}
+
+// Reads a custom template from a file.  The template is given a *Script,
+// and may use the functions quote, comment, hashCommand, upper, and add
+// as well as the standard ones.
+func ParseTemplate(path string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(path).Funcs(funcs).Parse(string(text))
+}
+
+const defaultTemplate = `#!/bin/sh
+#
+# Generated by ddet on {{.Generated.Format "2006-01-02 15:04:05"}} for {{comment .Root}}
+#
+# {{len .Groups}} groups of duplicates, {{.NumTargets}} files to {{if eq .Action "ln"}}replace with hardlinks{{else}}remove{{end}}
+# {{.Reclaimable}} bytes to be reclaimed
+#
+# Review this script before running it.  Each file is checked before it
+# is touched, and left alone if its length or contents have changed
+# since the script was generated;  a group is skipped entirely if the
+# file being kept has changed.
+
+ddet_failed=0
+
+# ddet_hash ALG FILE:  prints the hash of FILE
+ddet_hash() {
+	case "$1" in
+{{- range .HashAlgs}}
+	{{.}})
+		{{hashCommand .}} < "$2" | cut -d ' ' -f 1
+		;;
+{{- end}}
+	*)
+		echo "ddet: unknown hash algorithm $1" >&2
+		;;
+	esac
+}
+
+# ddet_check LENGTH ALG HASH FILE:  succeeds if FILE still has the
+# length and hash it had when this script was generated
+ddet_check() {
+	if [ ! -f "$4" ]; then
+		echo "ddet: missing, skipping: $4" >&2
+	elif [ "$(wc -c < "$4" | tr -d ' ')" != "$1" ]; then
+		echo "ddet: length changed, skipping: $4" >&2
+	elif [ "$(ddet_hash "$2" "$4")" != "$3" ]; then
+		echo "ddet: contents changed, skipping: $4" >&2
+	else
+		return 0
+	fi
+	return 1
+}
+
+# ddet_act KEEPER FILE:  {{if eq .Action "ln"}}replaces FILE with a hardlink to KEEPER{{else}}removes FILE{{end}}
+ddet_act() {
+{{- if eq .Action "ln"}}
+	ddet_tmp="$2.ddet-link.$$"
+	if ln -- "$1" "$ddet_tmp" && mv -f -- "$ddet_tmp" "$2"; then
+		return 0
+	fi
+	rm -f -- "$ddet_tmp"
+	return 1
+{{- else}}
+	rm -f -- "$2"
+{{- end}}
+}
+{{range $i, $g := .Groups}}
+# Group {{add $i 1}}:  {{upper $g.Keeper.HashAlg}} {{$g.Keeper.Hash}} and length {{$g.Keeper.Length}}, {{$g.Reclaimable}} bytes to be reclaimed
+# keep {{comment $g.Keeper.Path}} ({{comment $g.Reason}})
+{{- range $g.Protected}}
+# protected {{comment .Path}}
+{{- end}}
+if ddet_check {{$g.Keeper.Length}} {{$g.Keeper.HashAlg}} {{$g.Keeper.Hash}} {{quote $g.Keeper.Path}}; then
+{{- range $g.Targets}}
+	ddet_check {{.Length}} {{.HashAlg}} {{.Hash}} {{quote .Path}} && ddet_act {{quote $g.Keeper.Path}} {{quote .Path}} ||
+		ddet_failed=$((ddet_failed + 1))
+{{- end}}
+else
+	echo "ddet: skipping group {{add $i 1}}" >&2
+	ddet_failed=$((ddet_failed + {{len $g.Targets}}))
+fi
+{{end}}
+if [ "$ddet_failed" -ne 0 ]; then
+	echo "ddet: $ddet_failed files were left alone" >&2
+	exit 1
+fi
+`
@@ -0,0 +1,181 @@
+package script
+
+import (
+	"bytes"
+	"io/ioutil"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/keep"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected string
+	}{
+		{"", "''"},
+		{"/a/b c", "'/a/b c'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME `x` \\ \"y\"", "'$HOME `x` \\ \"y\"'"},
+	}
+	for _, c := range cases {
+		if got := Quote(c.s); got != c.expected {
+			t.Error("bad quoting for ", c.s, ", expected=", c.expected, ", got=", got)
+		}
+	}
+}
+
+func TestQuoteInShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+	for _, s := range []string{"plain", "it's", "two\nlines", "-n", "$(echo no) `echo no` *", "tab\there"} {
+		out, err := exec.Command(sh, "-c", "printf '%s' "+Quote(s)).Output()
+		if err != nil || string(out) != s {
+			t.Error("shell did not get back ", s, ", got ", string(out), err)
+		}
+	}
+}
+
+func TestComment(t *testing.T) {
+	if Comment("/a/b c") != "/a/b c" {
+		t.Error("plain strings should be unchanged")
+	}
+	if strings.Contains(Comment("a\nrm -rf /"), "\n") {
+		t.Error("newlines should be escaped")
+	}
+}
+
+func TestAddGroup(t *testing.T) {
+	entries := []filedb.FileEntry{
+		*filedb.NewTestFileEntry().SetPath("/a").SetDevice(1).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/b").SetDevice(1).SetInode(10),
+		*filedb.NewTestFileEntry().SetPath("/c").SetDevice(1).SetInode(11),
+		*filedb.NewTestFileEntry().SetPath("/d").SetDevice(1).SetInode(11),
+		*filedb.NewTestFileEntry().SetPath("/e").SetDevice(1).SetInode(12),
+	}
+	rules, _ := keep.ParseRules([]string{"never:/e"})
+	decision := keep.Decide(entries, rules)
+
+	s, _ := New(ActionRemove, "/")
+	s.AddGroup(entries, decision)
+	g := s.Groups[0]
+	if g.Keeper.Path != "/e" || len(g.Targets) != 4 || g.Reclaimable != 2*128 {
+		t.Error("bad group for rm, got ", g)
+	}
+
+	rules, _ = keep.ParseRules([]string{"never:/d"})
+	decision = keep.Decide(entries, rules)
+	s, _ = New(ActionLink, "/")
+	s.AddGroup(entries, decision)
+	g = s.Groups[0]
+	if g.Keeper.Path != "/d" || len(g.Targets) != 3 || g.Reclaimable != 2*128 {
+		t.Error("bad group for ln, got ", g)
+	}
+
+	_, err := New("mv", "/")
+	if err == nil {
+		t.Error("should have failed for unknown action")
+	}
+}
+
+// Writes identical files, then runs a script that acts on them after
+// one has been changed.
+func runTestScript(t *testing.T, action string) string {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+	if _, err := exec.LookPath("md5sum"); err != nil {
+		t.Skip("no md5sum")
+	}
+
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	names := []string{"/keep", "/it's a file", "/two\nlines", "/changed"}
+	var entries []filedb.FileEntry
+	for _, name := range names {
+		ioutil.WriteFile(dir+name, []byte("constant text string"), 0644)
+		entries = append(entries, *filedb.NewBlankFileEntry().SetPath(dir + name).SetLength(20).
+			SetHashAlg("md5").SetHash("c4547432b891a3ed2e6b16e58d42f97b"))
+	}
+
+	s, _ := New(action, dir)
+	s.AddGroup(entries, keep.Decision{Keeper: 0})
+	var buf bytes.Buffer
+	err = s.Write(&buf, DefaultTemplate())
+	if err != nil {
+		t.Fatal("unable to write script: ", err)
+	}
+
+	ioutil.WriteFile(dir+"/changed", []byte("constant text strinG"), 0644)
+	cmd := exec.Command(sh)
+	cmd.Stdin = &buf
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Error("script should have failed for the changed file")
+	}
+	if !strings.Contains(string(out), "contents changed") {
+		t.Error("script should have reported the changed file, got ", string(out))
+	}
+	if _, err := os.Stat(dir + "/changed"); err != nil {
+		t.Error("changed file should have been left alone")
+	}
+	if _, err := os.Stat(dir + "/keep"); err != nil {
+		t.Error("keeper should have been left alone")
+	}
+	return dir
+}
+
+func TestRemoveScript(t *testing.T) {
+	dir := runTestScript(t, ActionRemove)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"/it's a file", "/two\nlines"} {
+		if _, err := os.Stat(dir + name); !os.IsNotExist(err) {
+			t.Error("file should have been removed: ", name)
+		}
+	}
+}
+
+func TestLinkScript(t *testing.T) {
+	dir := runTestScript(t, ActionLink)
+	defer os.RemoveAll(dir)
+
+	keeper, _ := os.Stat(dir + "/keep")
+	for _, name := range []string{"/it's a file", "/two\nlines"} {
+		stat, err := os.Stat(dir + name)
+		if err != nil || !os.SameFile(keeper, stat) {
+			t.Error("file should have been linked: ", name)
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 4 {
+		t.Error("temporary links should have been renamed, got ", len(files), " files")
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/tmpl", []byte("{{range .Groups}}{{range .Targets}}del {{quote .Path}}\n{{end}}{{end}}"), 0644)
+
+	tmpl, err := ParseTemplate(dir + "/tmpl")
+	if err != nil {
+		t.Fatal("unable to parse template: ", err)
+	}
+	entries := []filedb.FileEntry{
+		*filedb.NewTestFileEntry().SetPath("/a"),
+		*filedb.NewTestFileEntry().SetPath("/b c"),
+	}
+	s, _ := New(ActionRemove, "/")
+	s.AddGroup(entries, keep.Decision{Keeper: 0})
+	var buf bytes.Buffer
+	s.Write(&buf, tmpl)
+	if buf.String() != "del '/b c'\n" {
+		t.Error("bad output, got ", buf.String())
+	}
+}
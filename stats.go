@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"lostbearlabs.com/ddet/dset"
+	"lostbearlabs.com/ddet/filedb"
+	"lostbearlabs.com/ddet/util"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Totals over the database entries beneath a path.
+type dbStats struct {
+	files           int
+	bytes           int64
+	fullyHashed     int
+	partiallyHashed int
+	hashAlgs        map[string]int
+	// the range of the times the files were last seen by a scan
+	firstScan int64
+	lastScan  int64
+}
+
+func (s *dbStats) add(e filedb.FileEntry) {
+	s.files++
+	s.bytes += e.Length
+	switch {
+	case e.Hash != "":
+		s.fullyHashed++
+	case e.PartialHash != "":
+		s.partiallyHashed++
+	}
+	if e.HashAlg != "" && (e.Hash != "" || e.PartialHash != "") {
+		s.hashAlgs[e.HashAlg]++
+	}
+	if s.firstScan == 0 || e.ScanTime < s.firstScan {
+		s.firstScan = e.ScanTime
+	}
+	if e.ScanTime > s.lastScan {
+		s.lastScan = e.ScanTime
+	}
+}
+
+// The "stats" command:  shows totals over the files in the database
+// beneath a path, and the duplicates among them, without scanning it
+// first.
+func runStats(args []string) int {
+	flags := newFlagSet("ddet stats", "ddet stats <path> [-v] [options]")
+	ff := addFilterFlags(flags)
+
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return parseFailure(err)
+	}
+	f, err := ff.filter(paths...)
+	if err != nil {
+		return usageError(flags, err)
+	}
+	if len(paths) != 1 {
+		return usageError(flags, errors.New("expected one path"))
+	}
+	path := paths[0]
+
+	db, err := ff.openDB()
+	if err != nil {
+		return commandError(err)
+	}
+	defer db.Close()
+
+	stats := dbStats{hashAlgs: make(map[string]int)}
+	err = db.ProcessAllFileEntries(func(e filedb.FileEntry) {
+		if util.IsWithin(e.Path, path) && f.MatchFile(e.Path) && f.MatchSize(e.Length) {
+			stats.add(e)
+		}
+	}, path)
+	if err != nil {
+		return commandError(err)
+	}
+
+	groups, duplicates := 0, 0
+	var reclaimable int64
+	ks, dupKeys := findDuplicates(db, []string{path}, f)
+	for _, key := range dupKeys {
+		entries, err := ks.GetFileEntries(db, key)
+		if err != nil {
+			return commandError(err)
+		}
+		entries = dset.EntriesWithin(entries, path)
+		if len(entries) < 2 {
+			continue
+		}
+		groups++
+		duplicates += len(entries)
+		reclaimable += dset.NewGroup(entries).Reclaimable()
+	}
+
+	var algs []string
+	for alg, n := range stats.hashAlgs {
+		algs = append(algs, fmt.Sprintf("%s %d", alg, n))
+	}
+	sort.Strings(algs)
+
+	fmt.Printf("Files:             %d\n", stats.files)
+	fmt.Printf("Total size:        %d bytes\n", stats.bytes)
+	fmt.Printf("Fully hashed:      %d\n", stats.fullyHashed)
+	fmt.Printf("Partially hashed:  %d\n", stats.partiallyHashed)
+	fmt.Printf("Not hashed:        %d\n", stats.files-stats.fullyHashed-stats.partiallyHashed)
+	if len(algs) > 0 {
+		fmt.Printf("Hash algorithms:   %s\n", strings.Join(algs, ", "))
+	}
+	if stats.files > 0 {
+		fmt.Printf("Last scanned:      %s to %s\n", formatScanTime(stats.firstScan), formatScanTime(stats.lastScan))
+	}
+	fmt.Printf("Duplicate groups:  %d\n", groups)
+	fmt.Printf("Duplicate files:   %d\n", duplicates)
+	fmt.Printf("Reclaimable:       %d bytes\n", reclaimable)
+	return exitOK
+}
+
+func formatScanTime(t int64) string {
+	return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,11 @@
+package util
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Returns true if path is dir or lies beneath it.
+func IsWithin(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
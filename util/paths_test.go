@@ -0,0 +1,24 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestIsWithin(t *testing.T) {
+	cases := []struct {
+		path, dir string
+		within    bool
+	}{
+		{"/a", "/a", true},
+		{"/a/b", "/a", true},
+		{"/a/b", "/a/", true},
+		{"/a/b", "/", true},
+		{"/ab", "/a", false},
+		{"/a", "/a/b", false},
+	}
+	for _, c := range cases {
+		if IsWithin(c.path, c.dir) != c.within {
+			t.Error("wrong result for ", c.path, " in ", c.dir)
+		}
+	}
+}
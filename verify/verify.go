@@ -0,0 +1,198 @@
+package verify
+
+import (
+	"bytes"
+	"github.com/juju/loggo"
+	"io"
+	"lostbearlabs.com/ddet/filedb"
+	"os"
+)
+
+var logger = loggo.GetLogger("verify")
+
+// The number of bytes read from each file at a time.
+const chunkSize = 64 * 1024
+
+// The most files we hold open at once while verifying a group.  Larger
+// groups are verified in batches, with one member of each set of
+// identical files found so far carried into the next batch.
+var MaxOpenFiles = 64
+
+// The result of verifying a group of files that share a key.
+type Result struct {
+	// sets of two or more files with identical contents
+	Identical [][]filedb.FileEntry
+	// files whose contents match no other member of the group
+	Different []filedb.FileEntry
+	// files whose length or lastMod no longer match the FileDB, i.e.
+	// that have changed since the last scan
+	Changed []filedb.FileEntry
+	// files that could not be read
+	Unreadable []filedb.FileEntry
+}
+
+// Returns true if the whole group was found to be identical.
+func (r *Result) AllIdentical() bool {
+	return len(r.Identical) == 1 && len(r.Different) == 0 && len(r.Changed) == 0 && len(r.Unreadable) == 0
+}
+
+// Compares the contents of a group of files byte-for-byte, splitting
+// the group into sets of files that really are identical.  Files are
+// read in lockstep, so each file is read only once however large the
+// group is.
+func Group(entries []filedb.FileEntry) *Result {
+	result := &Result{}
+
+	candidates := make([]filedb.FileEntry, 0, len(entries))
+	for _, entry := range entries {
+		stat, err := os.Stat(entry.Path)
+		switch {
+		case err != nil:
+			logger.Warningf("unable to stat file %s: %v", entry.Path, err)
+			result.Unreadable = append(result.Unreadable, entry)
+		case stat.Size() != entry.Length || stat.ModTime().Unix() != entry.LastMod:
+			result.Changed = append(result.Changed, entry)
+		default:
+			candidates = append(candidates, entry)
+		}
+	}
+
+	// Each class is a set of files known to be identical.  The first
+	// member of each class represents it in later batches.
+	var classes [][]filedb.FileEntry
+	next := 0
+	for next < len(candidates) {
+		batch := make([]filedb.FileEntry, 0, MaxOpenFiles)
+		for _, class := range classes {
+			batch = append(batch, class[0])
+		}
+		numReps := len(batch)
+		for next < len(candidates) && (len(batch) < MaxOpenFiles || len(batch) == numReps) {
+			batch = append(batch, candidates[next])
+			next++
+		}
+
+		parts, unreadable := partition(batch)
+		for _, i := range unreadable {
+			if i < numReps {
+				// a file we have already read once can't be read now;
+				// give up on its whole class
+				result.Unreadable = append(result.Unreadable, classes[i]...)
+				classes[i] = nil
+			} else {
+				result.Unreadable = append(result.Unreadable, batch[i])
+			}
+		}
+
+		var newClasses [][]filedb.FileEntry
+		for _, part := range parts {
+			var class []filedb.FileEntry
+			for _, i := range part {
+				if i < numReps {
+					class = append(class, classes[i]...)
+				} else {
+					class = append(class, batch[i])
+				}
+			}
+			if len(class) > 0 {
+				newClasses = append(newClasses, class)
+			}
+		}
+		classes = newClasses
+	}
+
+	for _, class := range classes {
+		if len(class) > 1 {
+			result.Identical = append(result.Identical, class)
+		} else {
+			result.Different = append(result.Different, class[0])
+		}
+	}
+
+	return result
+}
+
+// One file being read in lockstep with the others.
+type reader struct {
+	file  *os.File
+	chunk []byte
+	n     int
+	err   error
+}
+
+// Reads all the files in lockstep and splits them into sets of files
+// with identical contents.  Returns the sets (as indexes into paths)
+// and the indexes of any files that couldn't be read.
+func partition(entries []filedb.FileEntry) ([][]int, []int) {
+	readers := make([]*reader, len(entries))
+	var unreadable []int
+	var all []int
+	for i, entry := range entries {
+		file, err := os.Open(entry.Path)
+		if err != nil {
+			logger.Warningf("unable to open file %s: %v", entry.Path, err)
+			unreadable = append(unreadable, i)
+			continue
+		}
+		defer file.Close()
+		readers[i] = &reader{file: file, chunk: make([]byte, chunkSize)}
+		all = append(all, i)
+	}
+
+	var done [][]int
+	active := [][]int{all}
+	for len(active) > 0 {
+		var stillActive [][]int
+		for _, part := range active {
+			if len(part) < 2 {
+				done = append(done, part)
+				continue
+			}
+
+			// read the next chunk of every file in this set
+			var readable []int
+			for _, i := range part {
+				r := readers[i]
+				r.n, r.err = io.ReadFull(r.file, r.chunk)
+				if r.err == io.ErrUnexpectedEOF {
+					r.err = io.EOF
+				}
+				if r.err != nil && r.err != io.EOF {
+					logger.Warningf("unable to read file %s: %v", entries[i].Path, r.err)
+					unreadable = append(unreadable, i)
+					continue
+				}
+				readable = append(readable, i)
+			}
+
+			// split the set by chunk contents
+			var split [][]int
+			for _, i := range readable {
+				r := readers[i]
+				placed := false
+				for j, sub := range split {
+					rep := readers[sub[0]]
+					if rep.n == r.n && bytes.Equal(rep.chunk[:rep.n], r.chunk[:r.n]) {
+						split[j] = append(sub, i)
+						placed = true
+						break
+					}
+				}
+				if !placed {
+					split = append(split, []int{i})
+				}
+			}
+
+			for _, sub := range split {
+				if readers[sub[0]].err == io.EOF {
+					done = append(done, sub)
+				} else {
+					stillActive = append(stillActive, sub)
+				}
+			}
+		}
+		active = stillActive
+	}
+
+	return done, unreadable
+}
@@ -0,0 +1,117 @@
+package verify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"lostbearlabs.com/ddet/filedb"
+	"os"
+	"testing"
+)
+
+// Writes a file and returns a FileEntry that matches it.
+func writeEntry(t *testing.T, path string, data []byte) filedb.FileEntry {
+	ioutil.WriteFile(path, data, 0644)
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *filedb.NewTestFileEntry().SetPath(path).SetLength(stat.Size()).SetLastMod(stat.ModTime().Unix())
+}
+
+func TestIdenticalFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 3*chunkSize+5)
+	entries := []filedb.FileEntry{
+		writeEntry(t, dir+"/file1", data),
+		writeEntry(t, dir+"/file2", data),
+		writeEntry(t, dir+"/file3", data),
+	}
+
+	result := Group(entries)
+	if !result.AllIdentical() || len(result.Identical[0]) != 3 {
+		t.Error("all files should be identical, got ", result)
+	}
+}
+
+func TestDifferentFilesAreSplit(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 3*chunkSize)
+	e1 := writeEntry(t, dir+"/file1", data)
+	e2 := writeEntry(t, dir+"/file2", data)
+	data[2*chunkSize+1] = 1
+	e3 := writeEntry(t, dir+"/file3", data)
+	e4 := writeEntry(t, dir+"/file4", data)
+	data[len(data)-1] = 1
+	e5 := writeEntry(t, dir+"/file5", data)
+
+	result := Group([]filedb.FileEntry{e1, e3, e5, e2, e4})
+	if result.AllIdentical() {
+		t.Error("files should not all be identical")
+	}
+	if len(result.Identical) != 2 || len(result.Different) != 1 {
+		t.Error("should have split into 2 sets and 1 odd file, got ", result)
+		return
+	}
+	if result.Identical[0][0] != e1 || result.Identical[0][1] != e2 {
+		t.Error("wrong first set, got ", result.Identical[0])
+	}
+	if result.Identical[1][0] != e3 || result.Identical[1][1] != e4 {
+		t.Error("wrong second set, got ", result.Identical[1])
+	}
+	if result.Different[0] != e5 {
+		t.Error("wrong odd file, got ", result.Different[0])
+	}
+}
+
+func TestChangedAndMissingFilesAreFlagged(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	e1 := writeEntry(t, dir+"/file1", []byte("constant text string"))
+	e2 := writeEntry(t, dir+"/file2", []byte("constant text string"))
+	e3 := writeEntry(t, dir+"/file3", []byte("constant text string"))
+	ioutil.WriteFile(e2.Path, []byte("constant text string 22"), 0644)
+	os.Remove(e3.Path)
+
+	result := Group([]filedb.FileEntry{e1, e2, e3})
+	if len(result.Identical) != 0 || len(result.Different) != 1 {
+		t.Error("should have no identical files, got ", result)
+	}
+	if len(result.Changed) != 1 || result.Changed[0] != e2 {
+		t.Error("should have flagged changed file, got ", result.Changed)
+	}
+	if len(result.Unreadable) != 1 || result.Unreadable[0] != e3 {
+		t.Error("should have flagged missing file, got ", result.Unreadable)
+	}
+}
+
+func TestLargeGroupIsVerifiedInBatches(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "data")
+	defer os.RemoveAll(dir)
+
+	saved := MaxOpenFiles
+	MaxOpenFiles = 3
+	defer func() { MaxOpenFiles = saved }()
+
+	var entries []filedb.FileEntry
+	for i := 0; i < 10; i++ {
+		data := []byte("constant text string")
+		if i%3 == 0 {
+			data[0] = 'C'
+		}
+		entries = append(entries, writeEntry(t, fmt.Sprintf("%s/file%d", dir, i), data))
+	}
+
+	result := Group(entries)
+	if len(result.Identical) != 2 || len(result.Different) != 0 {
+		t.Error("should have found 2 sets, got ", result)
+		return
+	}
+	if len(result.Identical[0])+len(result.Identical[1]) != 10 {
+		t.Error("sets should include every file, got ", result.Identical)
+	}
+}